@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	ccid "github.com/kperanovic/epam-systems/internal/cid"
+	"github.com/kperanovic/epam-systems/internal/logger"
+	"go.uber.org/zap"
+)
+
+// CorrelationIDHeader is the request and response header carrying the correlation id.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// maxCorrelationIDLength limits the length of the correlation id accepted from the client,
+// since it is written into every log line and Kafka message of the request.
+const maxCorrelationIDLength = 128
+
+// CorrelationMiddleware stores the correlation id and the request logger in the request context.
+// Correlation id is read from the X-Correlation-ID header, or generated if the header is missing or too long,
+// and echoed in the response. Request logger is a child of the given logger carrying the correlation id and the route.
+func CorrelationMiddleware(log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cid := strings.TrimSpace(c.GetHeader(CorrelationIDHeader))
+		if cid == "" || len(cid) > maxCorrelationIDLength {
+			cid = ccid.New()
+		}
+
+		c.Header(CorrelationIDHeader, cid)
+
+		route := c.FullPath()
+		if route == "" {
+			// Request didn't match any route.
+			route = c.Request.URL.Path
+		}
+
+		ctx := ccid.WithContext(c.Request.Context(), cid)
+		ctx = logger.WithContext(ctx, log.With(
+			zap.String("cid", cid),
+			zap.String("route", c.Request.Method+" "+route),
+		))
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
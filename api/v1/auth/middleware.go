@@ -1,13 +1,15 @@
 package middleware
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kperanovic/epam-systems/api/v1/problem"
+	"github.com/kperanovic/epam-systems/internal/logger"
 	"github.com/kperanovic/epam-systems/internal/token"
+	"go.uber.org/zap"
 )
 
 const (
@@ -16,46 +18,35 @@ const (
 	authPayloadKey = "authorization_payload"
 )
 
+// RevocationChecker checks if a valid token was revoked before its expiry.
+// It is implemented by revocation.List.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, payload *token.Payload) (bool, error)
+}
+
 // AuthMiddleware is responsabile for request authentication.
 // It accepts JWT token. Checks if the header is provided and is the header in the right format.
 // Checks the validation type, and then validates the token sent in the header.
-func AuthMiddleware(t token.Token) gin.HandlerFunc {
+// Valid tokens are rejected if the checker reports them as revoked. Nil checker skips the check.
+func AuthMiddleware(t token.Token, revoked RevocationChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader(authHeaderKey)
 		if len(authHeader) == 0 {
-			err := errors.New("authorization header is not provided")
-			c.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{
-					"error": err,
-				},
-			)
+			problem.Abort(c, problem.Unauthorized("authorization header is not provided"))
 
 			return
 		}
 
 		fields := strings.Fields(authHeader)
 		if len(fields) < 2 {
-			err := errors.New("invalid authorization header format")
-			c.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{
-					"error": err,
-				},
-			)
+			problem.Abort(c, problem.Unauthorized("invalid authorization header format"))
 
 			return
 		}
 
 		authType := strings.ToLower(fields[0])
 		if authType != authTypeBearer {
-			err := fmt.Errorf("unsupported authorization type %v", authType)
-			c.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{
-					"error": err,
-				},
-			)
+			problem.Abort(c, problem.Unauthorized(fmt.Sprintf("unsupported authorization type %v", authType)))
 
 			return
 		}
@@ -63,12 +54,72 @@ func AuthMiddleware(t token.Token) gin.HandlerFunc {
 		accessToken := fields[1]
 		payload, err := t.VerifyToken(accessToken)
 		if err != nil {
-			c.AbortWithStatus(http.StatusUnauthorized)
+			problem.Abort(c, problem.Unauthorized("invalid access token"))
 
 			return
 		}
 
+		if revoked != nil {
+			isRevoked, err := revoked.IsRevoked(c.Request.Context(), payload)
+			if err != nil {
+				if log := logger.FromContext(c.Request.Context()); log != nil {
+					log.Error("error checking token revocation", zap.Error(err))
+				}
+
+				// Fail closed, a revoked token must not get through while the storage is unavailable.
+				problem.Abort(c, problem.Internal())
+
+				return
+			}
+
+			if isRevoked {
+				problem.Abort(c, problem.Unauthorized("access token has been revoked"))
+
+				return
+			}
+		}
+
 		c.Set(authPayloadKey, payload)
+
+		// Request logger set by CorrelationMiddleware logs the authenticated user as well.
+		if log := logger.FromContext(c.Request.Context()); log != nil {
+			log = log.With(zap.Stringer("userId", payload.UserID))
+			c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context(), log))
+		}
+
 		c.Next()
 	}
 }
+
+// RequireScope aborts the request unless its access token grants the scope.
+// It has to be used after the AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		payload, ok := PayloadFromContext(c)
+		if !ok {
+			problem.Abort(c, problem.Unauthorized("request is not authenticated"))
+
+			return
+		}
+
+		if !payload.HasScope(scope) {
+			problem.Abort(c, problem.Forbidden(fmt.Sprintf("access token doesn't grant the %s scope", scope)))
+
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// PayloadFromContext returns the token payload of the authenticated request.
+func PayloadFromContext(c *gin.Context) (*token.Payload, bool) {
+	payload, ok := c.Get(authPayloadKey)
+	if !ok {
+		return nil, false
+	}
+
+	p, ok := payload.(*token.Payload)
+
+	return p, ok
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kperanovic/epam-systems/internal/trace"
+)
+
+// TraceMiddleware stores the W3C trace context of the request in the request context.
+// If the request span was already started by the tracing middleware, its trace context is kept.
+// Otherwise trace context is parsed from the traceparent and tracestate headers,
+// and a new trace is started if the headers are missing or the trace parent is invalid.
+func TraceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := trace.FromContext(c.Request.Context()); ok {
+			c.Next()
+
+			return
+		}
+
+		tc, err := trace.Parse(c.GetHeader(trace.TraceParentHeader), c.GetHeader(trace.TraceStateHeader))
+		if err != nil {
+			tc = trace.New()
+		}
+
+		c.Request = c.Request.WithContext(trace.WithContext(c.Request.Context(), tc))
+		c.Next()
+	}
+}
@@ -0,0 +1,60 @@
+// Package events contains the protobuf schemas of the company events
+// published to Kafka. Every event is wrapped in an Envelope.
+package events
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative company.proto
+
+import "github.com/kperanovic/epam-systems/api/v1/types"
+
+// SchemaVersion is the version of the event schemas sent in the envelope.
+// It is incremented on breaking changes of the schemas.
+const SchemaVersion = 1
+
+// FromCompany converts the stored company to its event representation.
+func FromCompany(company *types.Company) *Company {
+	if company == nil {
+		return nil
+	}
+
+	return &Company{
+		Uuid:        company.ID.String(),
+		Name:        company.Name,
+		Description: company.Description,
+		Employees:   int32(company.Employees),
+		Registered:  company.Registered,
+		CompanyType: int32(company.CompanyType),
+		Version:     int32(company.Version),
+	}
+}
+
+// ChangedFields returns the names of the event Company fields
+// which differ between the two states. Version is not compared.
+func ChangedFields(before, after *types.Company) []string {
+	var fields []string
+
+	if before.ID != after.ID {
+		fields = append(fields, "uuid")
+	}
+
+	if before.Name != after.Name {
+		fields = append(fields, "name")
+	}
+
+	if before.Description != after.Description {
+		fields = append(fields, "description")
+	}
+
+	if before.Employees != after.Employees {
+		fields = append(fields, "employees")
+	}
+
+	if before.Registered != after.Registered {
+		fields = append(fields, "registered")
+	}
+
+	if before.CompanyType != after.CompanyType {
+		fields = append(fields, "company_type")
+	}
+
+	return fields
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/Shopify/sarama"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+	"github.com/kperanovic/epam-systems/internal/kafka"
+	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Company command names sent in the message name header.
+const (
+	CommandCreateCompany = "CREATE_COMPANY"
+	CommandUpdateCompany = "UPDATE_COMPANY"
+	CommandDeleteCompany = "DELETE_COMPANY"
+)
+
+// CommandHandlers apply the company commands consumed from Kafka.
+// Commands are validated like the REST requests and the resulting
+// company events are written into the outbox the same way.
+type CommandHandlers struct {
+	log      *zap.Logger
+	store    storage.Storage
+	encoding kafka.Encoding
+}
+
+// NewCommandHandlers creates the company Kafka command handlers.
+func NewCommandHandlers(log *zap.Logger, store storage.Storage, encoding kafka.Encoding) *CommandHandlers {
+	registerValidations()
+
+	return &CommandHandlers{
+		log:      log,
+		store:    store,
+		encoding: encoding,
+	}
+}
+
+// Register registers the command handlers on the consumer.
+func (h *CommandHandlers) Register(consumer *kafka.Consumer) {
+	consumer.Handle(CommandCreateCompany, h.HandleCreateCompany)
+	consumer.Handle(CommandUpdateCompany, h.HandleUpdateCompany)
+	consumer.Handle(CommandDeleteCompany, h.HandleDeleteCompany)
+}
+
+// HandleCreateCompany handles the CREATE_COMPANY command.
+// Payload is the same as the body of the POST endpoint.
+func (h *CommandHandlers) HandleCreateCompany(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	var req types.CompanyRequest
+
+	if err := bindCommand(msg, &req); err != nil {
+		return err
+	}
+
+	h.getLogger(ctx).Info("received createCompany command", zap.Any("req", req))
+
+	return commandError(h.store.SaveCompany(ctx, req.Company(), companyEvent(ctx, h.encoding, commandActor, EventCompanyCreated)))
+}
+
+// HandleUpdateCompany handles the UPDATE_COMPANY command.
+// Stored company is replaced with the one in the command.
+func (h *CommandHandlers) HandleUpdateCompany(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	var cmd types.UpdateCompanyCommand
+
+	if err := bindCommand(msg, &cmd); err != nil {
+		return err
+	}
+
+	h.getLogger(ctx).Info("received updateCompany command", zap.Any("cmd", cmd))
+
+	_, _, err := h.store.UpdateCompany(ctx, cmd.Company.ID, cmd.Version, func(current *types.Company) error {
+		*current = *cmd.Company.Company()
+
+		return nil
+	}, companyEvent(ctx, h.encoding, commandActor, EventCompanyUpdated))
+
+	return commandError(err)
+}
+
+// HandleDeleteCompany handles the DELETE_COMPANY command.
+func (h *CommandHandlers) HandleDeleteCompany(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	var cmd types.DeleteCompanyCommand
+
+	if err := bindCommand(msg, &cmd); err != nil {
+		return err
+	}
+
+	h.getLogger(ctx).Info("received deleteCompany command", zap.Any("cmd", cmd))
+
+	_, err := h.store.DeleteCompany(ctx, cmd.ID, cmd.Version, companyEvent(ctx, h.encoding, commandActor, EventCompanyDeleted))
+
+	return commandError(err)
+}
+
+// getLogger returns the message logger set by the consumer or the instance logger.
+func (h *CommandHandlers) getLogger(ctx context.Context) *zap.Logger {
+	if log := logger.FromContext(ctx); log != nil {
+		return log
+	}
+
+	return h.log
+}
+
+// bindCommand decodes and validates the command payload.
+// Invalid payloads are permanent errors, since retrying them can't succeed.
+func bindCommand(msg *sarama.ConsumerMessage, obj interface{}) error {
+	if err := json.Unmarshal(msg.Value, obj); err != nil {
+		return kafka.Permanent(err)
+	}
+
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		return kafka.Permanent(err)
+	}
+
+	return nil
+}
+
+// commandError marks the storage errors caused by the command itself as permanent.
+// Other errors (e.g. lost database connection) are returned unchanged to be retried.
+func commandError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrValidation),
+		errors.Is(err, storage.ErrNotFound),
+		errors.Is(err, storage.ErrConflict),
+		errors.Is(err, storage.ErrVersionMismatch):
+		return kafka.Permanent(err)
+	default:
+		return err
+	}
+}
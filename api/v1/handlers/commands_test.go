@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+	"github.com/kperanovic/epam-systems/internal/kafka"
+	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/storage"
+)
+
+// commandMessage creates a consumed message with the JSON encoded payload.
+func commandMessage(payload interface{}) *sarama.ConsumerMessage {
+	buf, _ := json.Marshal(payload)
+
+	return &sarama.ConsumerMessage{Value: buf}
+}
+
+func TestCommandHandlers(t *testing.T) {
+	// Initiate new CommandHandlers struct
+	h := NewCommandHandlers(logger.NewDevelopment(), storage.NewMemoryStorage(), kafka.EncodingProtobuf)
+	ctx := context.Background()
+
+	company := generateCompany()
+
+	// Create the company
+	err := h.HandleCreateCompany(ctx, commandMessage(company))
+	assert.Equal(t, err, nil)
+
+	// Update the company
+	employees := 0
+	registered := false
+	companyType := 2
+
+	err = h.HandleUpdateCompany(ctx, commandMessage(types.UpdateCompanyCommand{
+		Version: 1,
+		Company: types.CompanyRequest{
+			ID:          company.ID,
+			Name:        "updated",
+			Employees:   &employees,
+			Registered:  &registered,
+			CompanyType: &companyType,
+		},
+	}))
+	assert.Equal(t, err, nil)
+
+	updated, err := h.store.GetCompany(context.Background(), company.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, updated.Name, "updated")
+	assert.Equal(t, updated.Version, 2)
+
+	// Delete the company
+	err = h.HandleDeleteCompany(ctx, commandMessage(types.DeleteCompanyCommand{ID: company.ID}))
+	assert.Equal(t, err, nil)
+
+	// Every command wrote its event into the outbox
+	msgs, err := h.store.PendingMessages(10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(msgs), 3)
+	assert.Equal(t, msgs[0].Name, EventCompanyCreated)
+	assert.Equal(t, msgs[1].Name, EventCompanyUpdated)
+	assert.Equal(t, msgs[2].Name, EventCompanyDeleted)
+}
+
+func TestCommandHandlers_PermanentErrors(t *testing.T) {
+	// Initiate new CommandHandlers struct
+	h := NewCommandHandlers(logger.NewDevelopment(), storage.NewMemoryStorage(), kafka.EncodingProtobuf)
+	ctx := context.Background()
+
+	company := generateCompany()
+	h.store.SaveCompany(context.Background(), company, nil)
+
+	tests := []struct {
+		name   string
+		handle kafka.HandlerFunc
+		msg    *sarama.ConsumerMessage
+	}{
+		{
+			name:   "Test create command with invalid JSON",
+			handle: h.HandleCreateCompany,
+			msg:    &sarama.ConsumerMessage{Value: []byte("{")},
+		},
+		{
+			name:   "Test create command without required fields",
+			handle: h.HandleCreateCompany,
+			msg:    commandMessage(map[string]interface{}{"uuid": uuid.New()}),
+		},
+		{
+			name:   "Test create command for existing company",
+			handle: h.HandleCreateCompany,
+			msg:    commandMessage(company),
+		},
+		{
+			name:   "Test delete command for missing company",
+			handle: h.HandleDeleteCompany,
+			msg:    commandMessage(types.DeleteCompanyCommand{ID: uuid.New()}),
+		},
+		{
+			name:   "Test delete command with stale version",
+			handle: h.HandleDeleteCompany,
+			msg:    commandMessage(types.DeleteCompanyCommand{ID: company.ID, Version: 5}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.handle(ctx, tt.msg)
+			if !kafka.IsPermanent(err) {
+				t.Errorf("handler error = %v, want permanent error", err)
+			}
+		})
+	}
+}
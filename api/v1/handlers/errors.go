@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kperanovic/epam-systems/api/v1/problem"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"go.uber.org/zap"
+)
+
+// abortWithStorageError maps the storage error to the matching problem
+// and aborts the request. Unknown errors are logged and reported as 500.
+func (h *RESTHandlers) abortWithStorageError(c *gin.Context, err error) {
+	var (
+		p  *problem.Problem
+		fe *storage.FieldError
+	)
+
+	switch {
+	case errors.As(err, &p):
+		// Problems are returned from the update functions run by the storage.
+		problem.Abort(c, p)
+	case errors.As(err, &fe):
+		problem.Abort(c,
+			problem.UnprocessableEntity("invalid request. Please check the request body").
+				WithField(fe.Field, "", fe.Message),
+		)
+	case errors.Is(err, storage.ErrNotFound):
+		problem.Abort(c, problem.NotFound("company not found"))
+	case errors.Is(err, storage.ErrVersionMismatch):
+		problem.Abort(c, problem.PreconditionFailed("company was modified. Fetch the latest version and retry"))
+	case errors.Is(err, storage.ErrConflict):
+		problem.Abort(c, problem.Conflict("company already exists"))
+	case errors.Is(err, storage.ErrValidation):
+		problem.Abort(c, problem.UnprocessableEntity(err.Error()))
+	default:
+		h.getLogger(c.Request.Context()).Error("storage error", zap.Error(err))
+
+		problem.Abort(c, problem.Internal())
+	}
+}
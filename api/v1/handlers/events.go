@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	middleware "github.com/kperanovic/epam-systems/api/v1/auth"
+	"github.com/kperanovic/epam-systems/api/v1/events"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+	ccid "github.com/kperanovic/epam-systems/internal/cid"
+	"github.com/kperanovic/epam-systems/internal/kafka"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"github.com/kperanovic/epam-systems/internal/trace"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Company event names sent in the message name header.
+// Producer routes the events to the topics by their names.
+const (
+	EventCompanyCreated = "COMPANY_CREATED"
+	EventCompanyUpdated = "COMPANY_UPDATED"
+	EventCompanyDeleted = "COMPANY_DELETED"
+)
+
+// commandActor is the actor of the changes made by the Kafka commands.
+const commandActor = "kafka"
+
+// companyEvent returns the storage.EventFunc which writes the company event into the outbox.
+// Event is wrapped in an events.Envelope and encoded with the given encoding.
+// The content type is sent in the kafka.ContentTypeHeader. The correlation id and
+// the trace context of the request are stored with the event and sent in its headers.
+func companyEvent(ctx context.Context, encoding kafka.Encoding, actor, name string) storage.EventFunc {
+	return func(before, after *types.Company) (*storage.OutboxMessage, error) {
+		id := uuid.New()
+
+		env := &events.Envelope{
+			EventId:       id.String(),
+			OccurredAt:    timestamppb.Now(),
+			Actor:         actor,
+			SchemaVersion: events.SchemaVersion,
+		}
+
+		key := after
+
+		switch name {
+		case EventCompanyCreated:
+			env.Event = &events.Envelope_CompanyCreated{
+				CompanyCreated: &events.CompanyCreated{Company: events.FromCompany(after)},
+			}
+		case EventCompanyUpdated:
+			env.Event = &events.Envelope_CompanyUpdated{
+				CompanyUpdated: &events.CompanyUpdated{
+					Company:       events.FromCompany(after),
+					Previous:      events.FromCompany(before),
+					ChangedFields: events.ChangedFields(before, after),
+				},
+			}
+		case EventCompanyDeleted:
+			key = before
+			env.Event = &events.Envelope_CompanyDeleted{
+				CompanyDeleted: &events.CompanyDeleted{
+					Uuid:    before.ID.String(),
+					Company: events.FromCompany(before),
+				},
+			}
+		default:
+			return nil, fmt.Errorf("unknown company event %q", name)
+		}
+
+		buf, err := encoding.Encode(env)
+		if err != nil {
+			return nil, err
+		}
+
+		headers := map[string]string{
+			kafka.ContentTypeHeader: encoding.ContentType(),
+		}
+
+		if cid := ccid.FromContext(ctx); cid != "" {
+			headers[kafka.CIDHeader] = cid
+		}
+
+		trace.Inject(ctx, headers)
+
+		return &storage.OutboxMessage{
+			EventID: id,
+			Key:     key.ID.String(),
+			Name:    name,
+			Payload: buf,
+			Headers: headers,
+		}, nil
+	}
+}
+
+// requestActor returns the user id of the access token used for the request.
+func requestActor(c *gin.Context) string {
+	payload, ok := middleware.PayloadFromContext(c)
+	if !ok {
+		return ""
+	}
+
+	return payload.UserID.String()
+}
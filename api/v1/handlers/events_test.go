@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/events"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+	"github.com/kperanovic/epam-systems/internal/kafka"
+	"github.com/kperanovic/epam-systems/internal/trace"
+)
+
+func Test_companyEvent(t *testing.T) {
+	company := generateCompany()
+	company.Version = 2
+
+	previous := *company
+	previous.Version = 1
+	previous.Name = "old-name"
+
+	actor := uuid.New().String()
+
+	// Trace context of the request is carried by the event headers
+	tc := trace.New()
+	ctx := trace.WithContext(context.Background(), tc)
+
+	tests := []struct {
+		name     string
+		encoding kafka.Encoding
+		event    string
+		before   *types.Company
+		after    *types.Company
+	}{
+		{
+			name:     "Test created event encoded as protobuf",
+			encoding: kafka.EncodingProtobuf,
+			event:    EventCompanyCreated,
+			after:    company,
+		},
+		{
+			name:     "Test updated event encoded as JSON",
+			encoding: kafka.EncodingJSON,
+			event:    EventCompanyUpdated,
+			before:   &previous,
+			after:    company,
+		},
+		{
+			name:     "Test deleted event encoded as protobuf",
+			encoding: kafka.EncodingProtobuf,
+			event:    EventCompanyDeleted,
+			before:   company,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := companyEvent(ctx, tt.encoding, actor, tt.event)(tt.before, tt.after)
+			assert.Equal(t, err, nil)
+
+			assert.Equal(t, msg.Name, tt.event)
+			assert.Equal(t, msg.Key, company.ID.String())
+			assert.Equal(t, msg.Headers[kafka.ContentTypeHeader], tt.encoding.ContentType())
+			assert.Equal(t, msg.Headers[trace.TraceParentHeader], tc.TraceParent())
+
+			// Consumers decode the envelope by the content type header
+			var env events.Envelope
+			err = kafka.Decode(msg.Headers[kafka.ContentTypeHeader], msg.Payload, &env)
+			assert.Equal(t, err, nil)
+
+			assert.Equal(t, env.EventId, msg.EventID.String())
+			assert.Equal(t, env.Actor, actor)
+			assert.Equal(t, env.SchemaVersion, int32(events.SchemaVersion))
+			assert.Equal(t, env.OccurredAt.IsValid(), true)
+
+			switch tt.event {
+			case EventCompanyCreated:
+				assert.Equal(t, env.GetCompanyCreated().GetCompany().GetUuid(), company.ID.String())
+			case EventCompanyUpdated:
+				updated := env.GetCompanyUpdated()
+				assert.Equal(t, updated.GetCompany().GetVersion(), int32(2))
+				assert.Equal(t, updated.GetPrevious().GetVersion(), int32(1))
+				assert.Equal(t, updated.GetPrevious().GetName(), "old-name")
+				assert.Equal(t, updated.GetChangedFields(), []string{"name"})
+			case EventCompanyDeleted:
+				assert.Equal(t, env.GetCompanyDeleted().GetUuid(), company.ID.String())
+				assert.Equal(t, env.GetCompanyDeleted().GetCompany().GetName(), company.Name)
+			}
+		})
+	}
+}
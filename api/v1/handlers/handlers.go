@@ -2,164 +2,292 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/problem"
 	"github.com/kperanovic/epam-systems/api/v1/types"
 	"github.com/kperanovic/epam-systems/internal/kafka"
+	"github.com/kperanovic/epam-systems/internal/logger"
 	"github.com/kperanovic/epam-systems/internal/storage"
 	"go.uber.org/zap"
 )
 
+// ScopeCompanyWrite allows creating, updating and deleting the companies.
+const ScopeCompanyWrite = "company:write"
+
 type RESTHandlers struct {
 	log      *zap.Logger
 	store    storage.Storage
-	producer *kafka.Producer
+	encoding kafka.Encoding
+	producer ProducerStats
+	spool    SpoolDepth
+}
+
+// ProducerStats reports the delivery counters of the Kafka producer. It is implemented by kafka.Producer.
+type ProducerStats interface {
+	Stats() kafka.ProducerStats
+}
+
+// SpoolDepth reports the number of messages waiting in the Kafka spool. It is implemented by spool.Spool.
+type SpoolDepth interface {
+	Depth() int64
 }
 
-func NewRESTHandlers(log *zap.Logger, store storage.Storage, producer *kafka.Producer) *RESTHandlers {
+// NewRESTHandlers creates the company REST handlers.
+// Company events are not published by the handlers, they are written into the storage outbox
+// together with the change and published by the outbox relay, encoded with the given encoding.
+func NewRESTHandlers(log *zap.Logger, store storage.Storage, encoding kafka.Encoding) *RESTHandlers {
+	registerValidations()
+
 	return &RESTHandlers{
 		log:      log,
 		store:    store,
-		producer: producer,
+		encoding: encoding,
+	}
+}
+
+// WithProducer reports the delivery counters of the Kafka producer in the health endpoint.
+func (h *RESTHandlers) WithProducer(producer ProducerStats) *RESTHandlers {
+	h.producer = producer
+
+	return h
+}
+
+// WithSpool reports the depth of the Kafka spool in the health endpoint.
+func (h *RESTHandlers) WithSpool(spool SpoolDepth) *RESTHandlers {
+	h.spool = spool
+
+	return h
+}
+
+// getLogger returns the request logger set by the middleware or the instance logger.
+func (h *RESTHandlers) getLogger(ctx context.Context) *zap.Logger {
+	if log := logger.FromContext(ctx); log != nil {
+		return log
 	}
+
+	return h.log
 }
 
 // HandleGetCompany handles the GET endpoint "/v1/company/".
 // It will validate the request and fetch the data from storage.
 func (h *RESTHandlers) HandleGetCompany(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := bindCompanyID(c)
+	if !ok {
+		return
+	}
 
-	h.log.Info("received getCompany request", zap.String("id", id))
+	h.getLogger(c.Request.Context()).Info("received getCompany request", zap.Stringer("id", id))
 
-	company, err := h.store.GetCompany(uuid.MustParse(id))
+	company, err := h.store.GetCompany(c.Request.Context(), id)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "unable to fetch company",
-			})
+		h.abortWithStorageError(c, err)
 
 		return
+	}
 
+	c.Header(etagHeader, etag(company.Version))
+	c.JSON(http.StatusOK, company)
+}
+
+// HandleListCompanies handles the GET endpoint "/v1/company".
+// It will validate the query parameters and fetch a single page of companies from storage.
+// Next page can be fetched by sending the returned "nextCursor" as the "cursor" query parameter.
+func (h *RESTHandlers) HandleListCompanies(c *gin.Context) {
+	var query types.ListCompaniesQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		h.getLogger(c.Request.Context()).Error("error binding query parameters", zap.Error(err))
+
+		problem.Abort(c, problem.FromBindingError(err, "invalid request. Please check the query parameters"))
+
+		return
 	}
 
-	if company == nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest,
-			gin.H{
-				"message": "company not found",
-			})
+	h.getLogger(c.Request.Context()).Info("received listCompanies request", zap.Any("query", query))
+
+	companies, next, err := h.store.ListCompanies(c.Request.Context(), storage.ListOptions{
+		Name:         query.Name,
+		CompanyType:  query.CompanyType,
+		Registered:   query.Registered,
+		MinEmployees: query.MinEmployees,
+		MaxEmployees: query.MaxEmployees,
+		Sort:         query.Sort,
+		Limit:        query.Limit,
+		Cursor:       query.Cursor,
+	})
+	if err != nil {
+		h.abortWithStorageError(c, err)
 
 		return
 	}
 
-	c.JSON(http.StatusOK, company)
+	if companies == nil {
+		companies = []*types.Company{}
+	}
+
+	c.JSON(http.StatusOK, types.CompanyList{
+		Companies:  companies,
+		NextCursor: next,
+	})
 }
 
 // HandleCreateCompany handles the POST endpoint "/v1/company/".
 // It will validate the request body and save the data in storage.
-// On successfull save it will Send a Message in "company.commands" Kafka topic.
+// On successfull save the company event is written into the outbox.
 func (h *RESTHandlers) HandleCreateCompany(c *gin.Context) {
-	var company types.Company
+	var req types.CompanyRequest
 
 	// Check if required bindings are satisfied
-	if err := c.ShouldBindJSON(&company); err != nil {
-		h.log.Error("error binding request body", zap.Error(err))
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.getLogger(c.Request.Context()).Error("error binding request body", zap.Error(err))
 
-		c.AbortWithStatusJSON(http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "invalid request. Please check the request body",
-			})
+		problem.Abort(c, problem.FromBindingError(err, "invalid request. Please check the request body"))
 
 		return
 	}
 
-	h.log.Info("received createCompany request", zap.Any("req", company))
+	h.getLogger(c.Request.Context()).Info("received createCompany request", zap.Any("req", req))
 
-	if err := h.store.SaveCompany(&company); err != nil {
-		h.log.Error("error saving company", zap.Error(err))
+	company := req.Company()
 
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"message": "error occured while processing request",
-		})
+	ctx := c.Request.Context()
 
-		return
-	}
+	if err := h.store.SaveCompany(ctx, company, companyEvent(ctx, h.encoding, requestActor(c), EventCompanyCreated)); err != nil {
+		h.getLogger(c.Request.Context()).Error("error saving company", zap.Error(err))
 
-	if err := h.producer.SendMessage(context.TODO(), "company.commands", "", "COMPANY_CREATED", company); err != nil {
-		h.log.Error("error sending kafka message", zap.Error(err))
+		h.abortWithStorageError(c, err)
 
-		// Intentionally not returning an error since failing to send a message into kafka topic has nothing to do
-		// with the behaviour of the rest handler.
+		return
 	}
 
+	c.Header(etagHeader, etag(company.Version))
 	c.JSON(http.StatusOK, nil)
 }
 
-// HandlePatchCOmpany handles the PATCH endpoint "/v1/company/:id".
-// It will validate the request body and will update the existing data in storage.
-// On successfull update it will send a message in "company.commands" Kafka topic.
+// HandlePatchCompany handles the PATCH endpoint "/v1/company/:id".
+// Request body is a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) document,
+// selected by the Content-Type header. Plain JSON body is treated as a merge patch.
+// Patch is applied to the stored company and the result is validated and saved atomically.
+// If the If-Match header is sent, patch is only applied to the matching company version.
+// On successfull update the company event is written into the outbox.
 func (h *RESTHandlers) HandlePatchCompany(c *gin.Context) {
-	var company types.Company
+	id, ok := bindCompanyID(c)
+	if !ok {
+		return
+	}
 
-	id := c.Param("id")
+	version, ok := bindIfMatch(c)
+	if !ok {
+		return
+	}
 
-	// Check if required bindings are satisfied
-	if err := c.ShouldBindJSON(&company); err != nil {
-		h.log.Error("error binding request body", zap.Error(err))
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		problem.Abort(c, problem.BadRequest("invalid request. Unable to read the request body"))
 
-		c.AbortWithStatusJSON(http.StatusBadRequest,
-			gin.H{
-				"error":   err.Error(),
-				"message": "invalid request. Please check the request body",
-			})
+		return
+	}
+
+	patch, p := newPatcher(c.ContentType(), body)
+	if p != nil {
+		problem.Abort(c, p)
 
 		return
 	}
 
-	h.log.Info("received patchCompany request", zap.String("id", id), zap.Any("company", company))
+	h.getLogger(c.Request.Context()).Info("received patchCompany request", zap.Stringer("id", id), zap.ByteString("patch", body))
 
-	if err := h.store.UpdateCompany(uuid.MustParse(id), &company); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"message": "error occured while processing request",
-		})
+	ctx := c.Request.Context()
+
+	_, company, err := h.store.UpdateCompany(ctx, id, version, patchCompany(id, patch), companyEvent(ctx, h.encoding, requestActor(c), EventCompanyUpdated))
+	if err != nil {
+		h.abortWithStorageError(c, err)
 
 		return
 	}
 
-	if err := h.producer.SendMessage(context.TODO(), "company.commands", "", "COMPANY_UPDATED", company); err != nil {
-		h.log.Error("error sending kafka message", zap.Error(err))
+	c.Header(etagHeader, etag(company.Version))
+	c.JSON(http.StatusOK, company)
+}
+
+// HandlePutCompany handles the PUT endpoint "/v1/company/:id".
+// It will validate the request body and will replace the existing company in storage.
+// If the If-Match header is sent, only the matching company version is replaced.
+// On successfull update the company event is written into the outbox.
+func (h *RESTHandlers) HandlePutCompany(c *gin.Context) {
+	var req types.CompanyRequest
 
-		// Intentionally not returning an error since failing to send a message into kafka topic has nothing to do
-		// with the behaviour of the rest handler.
+	id, ok := bindCompanyID(c)
+	if !ok {
+		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	version, ok := bindIfMatch(c)
+	if !ok {
+		return
+	}
+
+	// Check if required bindings are satisfied
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.getLogger(c.Request.Context()).Error("error binding request body", zap.Error(err))
+
+		problem.Abort(c, problem.FromBindingError(err, "invalid request. Please check the request body"))
+
+		return
+	}
+
+	// Company id can't be changed, so the id in the body has to match the one in the path.
+	if req.ID != id {
+		problem.Abort(c, idMismatch())
+
+		return
+	}
+
+	h.getLogger(c.Request.Context()).Info("received putCompany request", zap.Stringer("id", id), zap.Any("req", req))
+
+	ctx := c.Request.Context()
+
+	_, company, err := h.store.UpdateCompany(ctx, id, version, func(current *types.Company) error {
+		*current = *req.Company()
+
+		return nil
+	}, companyEvent(ctx, h.encoding, requestActor(c), EventCompanyUpdated))
+	if err != nil {
+		h.abortWithStorageError(c, err)
+
+		return
+	}
+
+	c.Header(etagHeader, etag(company.Version))
+	c.JSON(http.StatusOK, company)
 }
 
 // HandleDeleteCompany handles the DELETE endpoint "/v1/company/:id".
 // It will validate the request body and will delete the existing data in storage.
-// On successfull delete it will send a message in "company.commands" Kafka topic.
+// If the If-Match header is sent, company is only deleted if the version matches.
+// On successfull delete the company event is written into the outbox.
 func (h *RESTHandlers) HandleDeleteCompany(c *gin.Context) {
-	id := c.Param("id")
-
-	h.log.Info("received deleteCompany request", zap.String("id", id))
-
-	if err := h.store.DeleteCompany(uuid.MustParse(id)); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"message": "error occured while processing request",
-		})
+	id, ok := bindCompanyID(c)
+	if !ok {
+		return
+	}
 
+	version, ok := bindIfMatch(c)
+	if !ok {
 		return
 	}
 
-	if err := h.producer.SendMessage(context.TODO(), "company.commands", "", "COMPANY_DELETED", id); err != nil {
-		h.log.Error("error sending kafka message", zap.Error(err))
+	h.getLogger(c.Request.Context()).Info("received deleteCompany request", zap.Stringer("id", id))
+
+	ctx := c.Request.Context()
 
-		// Intentionally not returning an error since failing to send a message into kafka topic has nothing to do
-		// with the behaviour of the rest handler.
+	if _, err := h.store.DeleteCompany(ctx, id, version, companyEvent(ctx, h.encoding, requestActor(c), EventCompanyDeleted)); err != nil {
+		h.abortWithStorageError(c, err)
+
+		return
 	}
 
 	c.JSON(http.StatusOK, nil)
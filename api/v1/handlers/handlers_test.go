@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,17 +11,21 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/Shopify/sarama/mocks"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
 	"github.com/google/uuid"
 	middleware "github.com/kperanovic/epam-systems/api/v1/auth"
+	"github.com/kperanovic/epam-systems/api/v1/problem"
 	"github.com/kperanovic/epam-systems/api/v1/types"
 	"github.com/kperanovic/epam-systems/internal/kafka"
 	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/outbox"
 	"github.com/kperanovic/epam-systems/internal/storage"
 	"github.com/kperanovic/epam-systems/internal/token"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func GinRouter() *gin.Engine {
@@ -45,13 +50,10 @@ func TestNewRESTHandlers(t *testing.T) {
 	// Create new dev logger
 	log := logger.NewDevelopment()
 
-	// Set new kafka mock producer
-	producer := kafka.NewMockProducer(mocks.NewSyncProducer(t, nil), log)
-
 	type args struct {
 		log      *zap.Logger
 		store    storage.Storage
-		producer *kafka.Producer
+		encoding kafka.Encoding
 	}
 	tests := []struct {
 		name string
@@ -63,18 +65,18 @@ func TestNewRESTHandlers(t *testing.T) {
 			args: args{
 				log:      log,
 				store:    storage.NewMemoryStorage(),
-				producer: producer,
+				encoding: kafka.EncodingProtobuf,
 			},
 			want: &RESTHandlers{
 				log:      log,
 				store:    storage.NewMemoryStorage(),
-				producer: producer,
+				encoding: kafka.EncodingProtobuf,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewRESTHandlers(tt.args.log, tt.args.store, tt.args.producer); !reflect.DeepEqual(got, tt.want) {
+			if got := NewRESTHandlers(tt.args.log, tt.args.store, tt.args.encoding); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewRESTHandlers() = %v, want %v", got, tt.want)
 			}
 		})
@@ -92,14 +94,14 @@ func TestRESTHandlers_HandleGetCompany(t *testing.T) {
 	h := NewRESTHandlers(
 		log,
 		storage.NewMemoryStorage(),
-		kafka.NewMockProducer(mocks.NewSyncProducer(t, nil), log),
+		kafka.EncodingJSON,
 	)
 
 	// generate new *types.Company struct
 	company := generateCompany()
 
 	// Save it in storage
-	err := h.store.SaveCompany(company)
+	err := h.store.SaveCompany(context.Background(), company, nil)
 	assert.Equal(t, err, nil)
 
 	// Define route
@@ -119,13 +121,13 @@ func TestRESTHandlers_HandleGetCompany(t *testing.T) {
 	}
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	// Test if invalid id is sent
+	// Test if unknown id is sent
 	req, _ = http.NewRequest("GET", fmt.Sprintf("/v1/company/%s", uuid.New()), nil)
 
 	w = httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
 func TestRESTHandlers_HandleCreateCompany(t *testing.T) {
@@ -135,16 +137,11 @@ func TestRESTHandlers_HandleCreateCompany(t *testing.T) {
 	// Define new dev logger
 	log := logger.NewDevelopment()
 
-	// Define new kafka mock producer and set mock expectation
-	// so that mock producer knows how to behave when it needs to send message.
-	mockProducer := mocks.NewSyncProducer(t, nil)
-	mockProducer.ExpectSendMessageAndSucceed()
-
 	// Initiate new RESTHandlers struct
 	h := NewRESTHandlers(
 		log,
 		storage.NewMemoryStorage(),
-		kafka.NewMockProducer(mockProducer, log),
+		kafka.EncodingJSON,
 	)
 
 	// generate new *types.Company struct
@@ -158,7 +155,7 @@ func TestRESTHandlers_HandleCreateCompany(t *testing.T) {
 	jsonValue, _ := json.Marshal(company)
 
 	// define a route
-	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j))
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
 	g.POST("/", h.HandleCreateCompany)
 
 	req, _ := http.NewRequest("POST", "/v1/company/", bytes.NewBuffer(jsonValue))
@@ -174,6 +171,82 @@ func TestRESTHandlers_HandleCreateCompany(t *testing.T) {
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The created event is waiting in the outbox
+	msgs, err := h.store.PendingMessages(10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(msgs), 1)
+	assert.Equal(t, msgs[0].Name, EventCompanyCreated)
+	assert.Equal(t, msgs[0].Key, company.ID.String())
+}
+
+func TestRESTHandlers_RequireScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		want   int
+	}{
+		{
+			name:   "Test write scope is granted",
+			scopes: []string{"company:read", ScopeCompanyWrite},
+			want:   http.StatusOK,
+		},
+		{
+			name:   "Test only read scope is granted",
+			scopes: []string{"company:read"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name: "Test no scope is granted",
+			want: http.StatusForbidden,
+		},
+	}
+
+	// Generate a token
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Define new gin router
+			r := GinRouter()
+
+			// Initiate new RESTHandlers struct
+			h := NewRESTHandlers(
+				logger.NewDevelopment(),
+				storage.NewMemoryStorage(),
+				kafka.EncodingJSON,
+			)
+
+			// define a route
+			g := r.Group("/v1/company").Use(
+				middleware.AuthMiddleware(j, nil),
+				middleware.RequireScope(ScopeCompanyWrite),
+			)
+			g.POST("/", h.HandleCreateCompany)
+
+			company := generateCompany()
+			jsonValue, _ := json.Marshal(company)
+
+			// create a token granting the scopes
+			accessToken, err := j.CreateToken(uuid.New(), company.Name, 10*time.Second, tt.scopes...)
+			assert.Equal(t, err, nil)
+
+			req, _ := http.NewRequest("POST", "/v1/company/", bytes.NewBuffer(jsonValue))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+
+			if tt.want == http.StatusForbidden {
+				assert.Equal(t, w.Header().Get("Content-Type"), problem.ContentType)
+
+				_, err = h.store.GetCompany(context.Background(), company.ID)
+				assert.Equal(t, err, storage.ErrNotFound)
+			}
+		})
+	}
 }
 
 func TestRESTHandlers_HandleCreateCompany_BadRequest(t *testing.T) {
@@ -183,16 +256,11 @@ func TestRESTHandlers_HandleCreateCompany_BadRequest(t *testing.T) {
 	// Define new dev logger
 	log := logger.NewDevelopment()
 
-	// Define new kafka mock producer and set mock expectation
-	// so that mock producer knows how to behave when it needs to send message.
-	mockProducer := mocks.NewSyncProducer(t, nil)
-	mockProducer.ExpectSendMessageAndSucceed()
-
 	// Initiate new RESTHandlers struct
 	h := NewRESTHandlers(
 		log,
 		storage.NewMemoryStorage(),
-		kafka.NewMockProducer(mockProducer, log),
+		kafka.EncodingJSON,
 	)
 
 	// Generate a token
@@ -213,7 +281,7 @@ func TestRESTHandlers_HandleCreateCompany_BadRequest(t *testing.T) {
 	jsonValue, _ := json.Marshal(company)
 
 	// Define the route
-	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j))
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
 	g.POST("/", h.HandleCreateCompany)
 
 	req, _ := http.NewRequest("POST", "/v1/company/", bytes.NewBuffer(jsonValue))
@@ -226,6 +294,19 @@ func TestRESTHandlers_HandleCreateCompany_BadRequest(t *testing.T) {
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+
+	// Check that the invalid name is reported with its json name
+	var got problem.Problem
+	err = json.Unmarshal(w.Body.Bytes(), &got)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, got.Status, http.StatusBadRequest)
+
+	fields := make(map[string]string)
+	for _, fe := range got.Errors {
+		fields[fe.Field] = fe.Rule
+	}
+	assert.Equal(t, fields["name"], "max")
 }
 
 func TestRESTHandlers_HandleCreateCompanyWithoutToken(t *testing.T) {
@@ -235,11 +316,6 @@ func TestRESTHandlers_HandleCreateCompanyWithoutToken(t *testing.T) {
 	// define new dev logger
 	log := logger.NewDevelopment()
 
-	// Define new kafka mock producer and set mock expectation
-	// so that mock producer knows how to behave when it needs to send message.
-	mockProducer := mocks.NewSyncProducer(t, nil)
-	mockProducer.ExpectSendMessageAndSucceed()
-
 	// generate new *types.Company struct
 	company := generateCompany()
 
@@ -247,7 +323,7 @@ func TestRESTHandlers_HandleCreateCompanyWithoutToken(t *testing.T) {
 	h := NewRESTHandlers(
 		log,
 		storage.NewMemoryStorage(),
-		kafka.NewMockProducer(mockProducer, log),
+		kafka.EncodingJSON,
 	)
 
 	// Generate the token
@@ -255,7 +331,7 @@ func TestRESTHandlers_HandleCreateCompanyWithoutToken(t *testing.T) {
 	assert.Equal(t, err, nil)
 
 	// Define the endpoint
-	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j))
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
 	g.POST("/", h.HandleCreateCompany)
 
 	// Marshal the request body
@@ -269,6 +345,12 @@ func TestRESTHandlers_HandleCreateCompanyWithoutToken(t *testing.T) {
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+
+	var got problem.Problem
+	err = json.Unmarshal(w.Body.Bytes(), &got)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, got.Detail, "authorization header is not provided")
 }
 
 func TestRESTHandlers_HandlePatchCompany(t *testing.T) {
@@ -278,11 +360,6 @@ func TestRESTHandlers_HandlePatchCompany(t *testing.T) {
 	// define new dev logger
 	log := logger.NewDevelopment()
 
-	// Define new kafka mock producer and set mock expectation
-	// so that mock producer knows how to behave when it needs to send message.
-	mockProducer := mocks.NewSyncProducer(t, nil)
-	mockProducer.ExpectSendMessageAndSucceed()
-
 	// generate new *types.Company struct
 	company := generateCompany()
 
@@ -290,14 +367,15 @@ func TestRESTHandlers_HandlePatchCompany(t *testing.T) {
 	h := NewRESTHandlers(
 		log,
 		storage.NewMemoryStorage(),
-		kafka.NewMockProducer(mockProducer, log),
+		kafka.EncodingJSON,
 	)
 
 	// First we save the original value in storage
-	h.store.SaveCompany(company)
+	h.store.SaveCompany(context.Background(), company, nil)
 
 	// make new company struct with different data
 	patched := generateCompany()
+	patched.ID = company.ID
 	patched.Employees = 500
 	patched.Description = "This is a changed description"
 
@@ -309,8 +387,8 @@ func TestRESTHandlers_HandlePatchCompany(t *testing.T) {
 	jsonValue, _ := json.Marshal(patched)
 
 	// Declare PATCH endpoint and generate a request
-	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j))
-	g.PATCH("/:id", h.HandlePatchCompany).Use(middleware.AuthMiddleware(j))
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.PATCH("/:id", h.HandlePatchCompany).Use(middleware.AuthMiddleware(j, nil))
 	req, _ := http.NewRequest("PATCH", fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBuffer(jsonValue))
 
 	// Create JWT auth token
@@ -325,11 +403,32 @@ func TestRESTHandlers_HandlePatchCompany(t *testing.T) {
 	r.ServeHTTP(w, req)
 
 	// Get patched data from storage
-	got, _ := h.store.GetCompany(company.ID)
+	got, _ := h.store.GetCompany(context.Background(), company.ID)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.NotEqual(t, company.Employees, got.Employees)
 	assert.NotEqual(t, company.Description, got.Description)
+
+	// Patching with a uuid in the body that doesn't match the path should be rejected
+	mismatched := generateCompany()
+	jsonValue, _ = json.Marshal(mismatched)
+
+	req, _ = http.NewRequest("PATCH", fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBuffer(jsonValue))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Patching an unknown company should report it is missing
+	req, _ = http.NewRequest("PATCH", fmt.Sprintf("/v1/company/%s", mismatched.ID), bytes.NewBuffer(jsonValue))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
 func TestRESTHandlers_HandlePatchCompany_WithoutToken(t *testing.T) {
@@ -339,11 +438,6 @@ func TestRESTHandlers_HandlePatchCompany_WithoutToken(t *testing.T) {
 	// define new dev logger
 	log := logger.NewDevelopment()
 
-	// Define new kafka mock producer and set mock expectation
-	// so that mock producer knows how to behave when it needs to send message.
-	mockProducer := mocks.NewSyncProducer(t, nil)
-	mockProducer.ExpectSendMessageAndSucceed()
-
 	// generate new *types.Company struct
 	company := generateCompany()
 
@@ -351,7 +445,7 @@ func TestRESTHandlers_HandlePatchCompany_WithoutToken(t *testing.T) {
 	h := NewRESTHandlers(
 		log,
 		storage.NewMemoryStorage(),
-		kafka.NewMockProducer(mockProducer, log),
+		kafka.EncodingJSON,
 	)
 
 	// Generate a token
@@ -362,8 +456,8 @@ func TestRESTHandlers_HandlePatchCompany_WithoutToken(t *testing.T) {
 	jsonValue, _ := json.Marshal(company)
 
 	// Declare PATCH endpoint and generate a request
-	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j))
-	g.PATCH("/:id", h.HandlePatchCompany).Use(middleware.AuthMiddleware(j))
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.PATCH("/:id", h.HandlePatchCompany).Use(middleware.AuthMiddleware(j, nil))
 	req, _ := http.NewRequest("PATCH", fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBuffer(jsonValue))
 
 	// Make a request
@@ -380,11 +474,6 @@ func TestRESTHandlers_HandleDeleteCompany(t *testing.T) {
 	// define new dev logger
 	log := logger.NewDevelopment()
 
-	// Define new kafka mock producer and set mock expectation
-	// so that mock producer knows how to behave when it needs to send message.
-	mockProducer := mocks.NewSyncProducer(t, nil)
-	mockProducer.ExpectSendMessageAndSucceed()
-
 	// generate new *types.Company struct
 	company := generateCompany()
 
@@ -392,11 +481,11 @@ func TestRESTHandlers_HandleDeleteCompany(t *testing.T) {
 	h := NewRESTHandlers(
 		log,
 		storage.NewMemoryStorage(),
-		kafka.NewMockProducer(mockProducer, log),
+		kafka.EncodingJSON,
 	)
 
 	// save company in storage
-	h.store.SaveCompany(company)
+	h.store.SaveCompany(context.Background(), company, nil)
 
 	// Generate a token
 	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
@@ -406,8 +495,8 @@ func TestRESTHandlers_HandleDeleteCompany(t *testing.T) {
 	jsonValue, _ := json.Marshal(company)
 
 	// Declare PATCH endpoint and generate a request
-	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j))
-	g.DELETE("/:id", h.HandleDeleteCompany).Use(middleware.AuthMiddleware(j))
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.DELETE("/:id", h.HandleDeleteCompany).Use(middleware.AuthMiddleware(j, nil))
 	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBuffer(jsonValue))
 
 	// Create JWT auth token
@@ -422,11 +511,20 @@ func TestRESTHandlers_HandleDeleteCompany(t *testing.T) {
 	r.ServeHTTP(w, req)
 
 	// Try to fetch deleted company from store
-	got, err := h.store.GetCompany(company.ID)
+	got, err := h.store.GetCompany(context.Background(), company.ID)
 
-	assert.Equal(t, err, nil)
+	assert.Equal(t, err, storage.ErrNotFound)
 	assert.Equal(t, got, nil)
 	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Deleting the same company again should report it is missing
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/v1/company/%s", company.ID), nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
 func TestRESTHandlers_HandleDeleteCompany_WithoutToken(t *testing.T) {
@@ -436,11 +534,6 @@ func TestRESTHandlers_HandleDeleteCompany_WithoutToken(t *testing.T) {
 	// define new dev logger
 	log := logger.NewDevelopment()
 
-	// Define new kafka mock producer and set mock expectation
-	// so that mock producer knows how to behave when it needs to send message.
-	mockProducer := mocks.NewSyncProducer(t, nil)
-	mockProducer.ExpectSendMessageAndSucceed()
-
 	// generate new *types.Company struct
 	company := generateCompany()
 
@@ -448,11 +541,11 @@ func TestRESTHandlers_HandleDeleteCompany_WithoutToken(t *testing.T) {
 	h := NewRESTHandlers(
 		log,
 		storage.NewMemoryStorage(),
-		kafka.NewMockProducer(mockProducer, log),
+		kafka.EncodingJSON,
 	)
 
 	// save company in storage
-	h.store.SaveCompany(company)
+	h.store.SaveCompany(context.Background(), company, nil)
 
 	// Generate a token
 	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
@@ -462,8 +555,8 @@ func TestRESTHandlers_HandleDeleteCompany_WithoutToken(t *testing.T) {
 	jsonValue, _ := json.Marshal(company)
 
 	// Declare PATCH endpoint and generate a request
-	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j))
-	g.DELETE("/:id", h.HandleDeleteCompany).Use(middleware.AuthMiddleware(j))
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.DELETE("/:id", h.HandleDeleteCompany).Use(middleware.AuthMiddleware(j, nil))
 	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBuffer(jsonValue))
 
 	// Make a request
@@ -472,3 +565,634 @@ func TestRESTHandlers_HandleDeleteCompany_WithoutToken(t *testing.T) {
 
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
+
+func TestRESTHandlers_HandleListCompanies(t *testing.T) {
+	// Define new gin router
+	r := GinRouter()
+
+	// Set new dev logger
+	log := logger.NewDevelopment()
+
+	// Initiate new RESTHandlers struct
+	h := NewRESTHandlers(
+		log,
+		storage.NewMemoryStorage(),
+		kafka.EncodingJSON,
+	)
+
+	// Save a few companies with different employee count
+	for i := 1; i <= 3; i++ {
+		company := generateCompany()
+		company.Employees = i * 10
+
+		err := h.store.SaveCompany(context.Background(), company, nil)
+		assert.Equal(t, err, nil)
+	}
+
+	// Define route
+	r.GET("/v1/company", h.HandleListCompanies)
+
+	// Fetch first page
+	req, _ := http.NewRequest("GET", "/v1/company?minEmployees=20&sort=-employees&limit=1", nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var page types.CompanyList
+	err := json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(page.Companies), 1)
+	assert.Equal(t, page.Companies[0].Employees, 30)
+	assert.NotEqual(t, page.NextCursor, "")
+
+	// Fetch the second and last page
+	req, _ = http.NewRequest("GET", "/v1/company?minEmployees=20&sort=-employees&limit=1&cursor="+page.NextCursor, nil)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	page = types.CompanyList{}
+	err = json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(page.Companies), 1)
+	assert.Equal(t, page.Companies[0].Employees, 20)
+	assert.Equal(t, page.NextCursor, "")
+
+	// Test if invalid cursor is sent
+	req, _ = http.NewRequest("GET", "/v1/company?cursor=invalid", nil)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Test if unsupported sort key is sent
+	req, _ = http.NewRequest("GET", "/v1/company?sort=description", nil)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRESTHandlers_InvalidCompanyID(t *testing.T) {
+	// Define new gin router
+	r := GinRouter()
+
+	// Set new dev logger
+	log := logger.NewDevelopment()
+
+	// Initiate new RESTHandlers struct
+	h := NewRESTHandlers(
+		log,
+		storage.NewMemoryStorage(),
+		kafka.EncodingJSON,
+	)
+
+	// Generate a token
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	token, err := j.CreateToken(uuid.New(), "test-company", 10*time.Second)
+	assert.Equal(t, err, nil)
+
+	// Define routes
+	r.GET("/v1/company/:id", h.HandleGetCompany)
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.PATCH("/:id", h.HandlePatchCompany)
+	g.DELETE("/:id", h.HandleDeleteCompany)
+
+	jsonValue, _ := json.Marshal(generateCompany())
+
+	for _, method := range []string{"GET", "PATCH", "DELETE"} {
+		req, _ := http.NewRequest(method, "/v1/company/foo", bytes.NewBuffer(jsonValue))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+		// Make a request
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestRESTHandlers_HandleCreateCompany_Validation(t *testing.T) {
+	// Define new gin router
+	r := GinRouter()
+
+	// Define new dev logger
+	log := logger.NewDevelopment()
+
+	// Initiate new RESTHandlers struct
+	h := NewRESTHandlers(
+		log,
+		storage.NewMemoryStorage(),
+		kafka.EncodingJSON,
+	)
+
+	// Generate a token
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	token, err := j.CreateToken(uuid.New(), "test-company", 10*time.Second)
+	assert.Equal(t, err, nil)
+
+	// Define the route
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.POST("/", h.HandleCreateCompany)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{
+			name: "zero values are accepted",
+			body: `{"uuid": "%s", "name": "zero", "employees": 0, "registered": false, "companyType": 1}`,
+			want: http.StatusOK,
+		},
+		{
+			name: "missing fields are rejected",
+			body: `{"uuid": "%s", "name": "missing"}`,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "negative employees are rejected",
+			body: `{"uuid": "%s", "name": "negative", "employees": -1, "registered": true, "companyType": 1}`,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "unknown company type is rejected",
+			body: `{"uuid": "%s", "name": "unknown", "employees": 1, "registered": true, "companyType": 42}`,
+			want: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(tt.body, uuid.New())
+
+			req, _ := http.NewRequest("POST", "/v1/company/", bytes.NewBufferString(body))
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			// Make request
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestRESTHandlers_HandlePatchCompany_MediaTypes(t *testing.T) {
+	// define the gin router
+	r := GinRouter()
+
+	// define new dev logger
+	log := logger.NewDevelopment()
+
+	// Initiate new RESTHandlers struct
+	h := NewRESTHandlers(
+		log,
+		storage.NewMemoryStorage(),
+		kafka.EncodingJSON,
+	)
+
+	// Generate a token
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	token, err := j.CreateToken(uuid.New(), "test-company", 10*time.Second)
+	assert.Equal(t, err, nil)
+
+	// Declare PATCH endpoint
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.PATCH("/:id", h.HandlePatchCompany)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantCode    int
+		check       func(t *testing.T, got *types.Company)
+	}{
+		{
+			name:        "merge patch sets zero values and keeps other fields",
+			contentType: MergePatchContentType,
+			body:        `{"registered": false, "employees": 0}`,
+			wantCode:    http.StatusOK,
+			check: func(t *testing.T, got *types.Company) {
+				assert.Equal(t, got.Registered, false)
+				assert.Equal(t, got.Employees, 0)
+				assert.Equal(t, got.Name, "test-company")
+			},
+		},
+		{
+			name:        "merge patch removing a required field is rejected",
+			contentType: MergePatchContentType,
+			body:        `{"name": null}`,
+			wantCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "json patch replaces a single field",
+			contentType: JSONPatchContentType,
+			body:        `[{"op": "replace", "path": "/description", "value": "patched"}]`,
+			wantCode:    http.StatusOK,
+			check: func(t *testing.T, got *types.Company) {
+				assert.Equal(t, got.Description, "patched")
+				assert.Equal(t, got.Employees, 10)
+			},
+		},
+		{
+			name:        "json patch with failing test operation is rejected",
+			contentType: JSONPatchContentType,
+			body:        `[{"op": "test", "path": "/name", "value": "other"}, {"op": "remove", "path": "/description"}]`,
+			wantCode:    http.StatusConflict,
+		},
+		{
+			name:        "malformed json patch is rejected",
+			contentType: JSONPatchContentType,
+			body:        `{"op": "replace"}`,
+			wantCode:    http.StatusBadRequest,
+		},
+		{
+			name:        "unsupported content type is rejected",
+			contentType: "text/plain",
+			body:        `name=other`,
+			wantCode:    http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Save a fresh company for every case
+			company := generateCompany()
+			err := h.store.SaveCompany(context.Background(), company, nil)
+			assert.Equal(t, err, nil)
+
+			req, _ := http.NewRequest("PATCH", fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBufferString(tt.body))
+			req.Header.Add("Content-Type", tt.contentType)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			// Make a request
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+
+			// Check stored company
+			if tt.check != nil {
+				got, err := h.store.GetCompany(context.Background(), company.ID)
+				assert.Equal(t, err, nil)
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestRESTHandlers_HandlePutCompany(t *testing.T) {
+	// define the gin router
+	r := GinRouter()
+
+	// define new dev logger
+	log := logger.NewDevelopment()
+
+	// generate new *types.Company struct
+	company := generateCompany()
+
+	// Initiate new RESTHandlers struct
+	h := NewRESTHandlers(
+		log,
+		storage.NewMemoryStorage(),
+		kafka.EncodingJSON,
+	)
+
+	// First we save the original value in storage
+	h.store.SaveCompany(context.Background(), company, nil)
+
+	// Generate a token
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	token, err := j.CreateToken(uuid.New(), company.Name, 10*time.Second)
+	assert.Equal(t, err, nil)
+
+	// Declare PUT endpoint
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.PUT("/:id", h.HandlePutCompany)
+
+	// Replace the company, leaving out the optional description
+	body := fmt.Sprintf(`{"uuid": "%s", "name": "replaced", "employees": 0, "registered": false, "companyType": 2}`, company.ID)
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBufferString(body))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	// Make a request
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	got, _ := h.store.GetCompany(context.Background(), company.ID)
+	assert.Equal(t, got, &types.Company{
+		ID:          company.ID,
+		Name:        "replaced",
+		CompanyType: 2,
+		Version:     2,
+	})
+
+	// Replacing the company with the same values is a no-op
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBufferString(body))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, w.Header().Get("ETag"), `"2"`)
+
+	// Only the first update wrote an event
+	msgs, err := h.store.PendingMessages(10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(msgs), 1)
+
+	// Partial body is rejected since PUT replaces the whole company
+	body = fmt.Sprintf(`{"uuid": "%s", "name": "partial"}`, company.ID)
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBufferString(body))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRESTHandlers_IfMatch(t *testing.T) {
+	// define the gin router
+	r := GinRouter()
+
+	// define new dev logger
+	log := logger.NewDevelopment()
+
+	// generate new *types.Company struct
+	company := generateCompany()
+
+	// Initiate new RESTHandlers struct
+	h := NewRESTHandlers(
+		log,
+		storage.NewMemoryStorage(),
+		kafka.EncodingJSON,
+	)
+
+	// First we save the original value in storage
+	h.store.SaveCompany(context.Background(), company, nil)
+
+	// Generate a token
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	token, err := j.CreateToken(uuid.New(), company.Name, 10*time.Second)
+	assert.Equal(t, err, nil)
+
+	// Declare endpoints
+	r.GET("/v1/company/:id", h.HandleGetCompany)
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.PATCH("/:id", h.HandlePatchCompany)
+	g.DELETE("/:id", h.HandleDeleteCompany)
+
+	send := func(method, etag, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, fmt.Sprintf("/v1/company/%s", company.ID), bytes.NewBufferString(body))
+		req.Header.Add("Content-Type", MergePatchContentType)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		if etag != "" {
+			req.Header.Add("If-Match", etag)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	// GET returns the current version as ETag
+	w := send("GET", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	// Patch with the current version succeeds and returns the new ETag
+	w = send("PATCH", `"1"`, `{"employees": 20}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// Second patch with the same, now stale, version fails
+	w = send("PATCH", `"1"`, `{"employees": 30}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Weak ETags never match
+	w = send("PATCH", `W/"2"`, `{"employees": 30}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	got, _ := h.store.GetCompany(context.Background(), company.ID)
+	assert.Equal(t, got.Employees, 20)
+
+	// Delete with a stale version fails
+	w = send("DELETE", `"1"`, "")
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Delete with the current version succeeds
+	w = send("DELETE", `"2"`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// producerStats returns fixed Kafka producer delivery counters.
+type producerStats kafka.ProducerStats
+
+func (s producerStats) Stats() kafka.ProducerStats {
+	return kafka.ProducerStats(s)
+}
+
+func TestRESTHandlers_HandleHealth(t *testing.T) {
+	// Define new gin router
+	r := GinRouter()
+
+	// Initiate new RESTHandlers struct
+	h := NewRESTHandlers(
+		logger.NewDevelopment(),
+		storage.NewMemoryStorage(),
+		kafka.EncodingJSON,
+	).WithProducer(producerStats{Sent: 3, Failed: 1, Buffered: 2})
+
+	r.GET("/health", h.HandleHealth)
+
+	// Save a company, so there is a pending event
+	err := h.store.SaveCompany(context.Background(), generateCompany(), companyEvent(context.Background(), kafka.EncodingJSON, "", EventCompanyCreated))
+	assert.Equal(t, err, nil)
+
+	req, _ := http.NewRequest("GET", "/health", nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var health HealthStatus
+	err = json.Unmarshal(w.Body.Bytes(), &health)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, health.Outbox.Pending, int64(1))
+	assert.Equal(t, health.Producer, &ProducerHealth{Sent: 3, Failed: 1, Buffered: 2})
+	assert.Equal(t, health.Spool, nil)
+
+	// Spool depth is reported once the spool is set
+	h.WithSpool(testSpool(2))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	err = json.Unmarshal(w.Body.Bytes(), &health)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, health.Spool, &SpoolHealth{Pending: 2})
+}
+
+// testSpool is a SpoolDepth with a fixed depth.
+type testSpool int64
+
+func (s testSpool) Depth() int64 { return int64(s) }
+
+func TestRESTHandlers_EventPartitionKey(t *testing.T) {
+	// Define new gin router
+	r := GinRouter()
+
+	// Set new dev logger
+	log := logger.NewDevelopment()
+
+	// Initiate new RESTHandlers struct
+	h := NewRESTHandlers(
+		log,
+		storage.NewMemoryStorage(),
+		kafka.EncodingJSON,
+	)
+
+	// generate new *types.Company struct
+	company := generateCompany()
+
+	// Generate a token
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	token, err := j.CreateToken(uuid.New(), company.Name, 10*time.Second)
+	assert.Equal(t, err, nil)
+
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.POST("/", h.HandleCreateCompany)
+	g.DELETE("/:id", h.HandleDeleteCompany)
+
+	// Create and delete the company
+	jsonValue, _ := json.Marshal(company)
+	req, _ := http.NewRequest("POST", "/v1/company/", bytes.NewBuffer(jsonValue))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/v1/company/%s", company.ID), nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Both events have to be keyed by the company id, so they land on the same partition
+	expectKey := func(msg *sarama.ProducerMessage) error {
+		key, err := msg.Key.Encode()
+		if err != nil {
+			return err
+		}
+
+		if string(key) != company.ID.String() {
+			return fmt.Errorf("message key = %q, want %q", key, company.ID)
+		}
+
+		return nil
+	}
+
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectKey)
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectKey)
+
+	producer := kafka.NewMockProducer(mockProducer, kafka.Routes{Default: "company.commands"}, log)
+
+	// Publish the events from the outbox
+	n, err := outbox.NewRelay(log, h.store, producer, 0, 0).Flush(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 2)
+
+	assert.Equal(t, mockProducer.Close(), nil)
+}
+
+func TestRESTHandlers_CorrelationID(t *testing.T) {
+	// Define new gin router
+	r := GinRouter()
+
+	// Record the logs written through the request logger
+	core, logs := observer.New(zap.InfoLevel)
+
+	// Initiate new RESTHandlers struct
+	h := NewRESTHandlers(
+		logger.NewDevelopment(),
+		storage.NewMemoryStorage(),
+		kafka.EncodingJSON,
+	)
+
+	company := generateCompany()
+	userID := uuid.New()
+
+	// Generate a token
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	token, err := j.CreateToken(userID, company.Name, 10*time.Second)
+	assert.Equal(t, err, nil)
+
+	r.Use(middleware.CorrelationMiddleware(zap.New(core)))
+	g := r.Group("/v1/company").Use(middleware.AuthMiddleware(j, nil))
+	g.POST("/", h.HandleCreateCompany)
+
+	// Correlation id sent by the client is echoed and carried by the event
+	jsonValue, _ := json.Marshal(company)
+	req, _ := http.NewRequest("POST", "/v1/company/", bytes.NewBuffer(jsonValue))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Add(middleware.CorrelationIDHeader, "client-cid")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, w.Header().Get(middleware.CorrelationIDHeader), "client-cid")
+
+	msgs, err := h.store.PendingMessages(10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(msgs), 1)
+	assert.Equal(t, msgs[0].Headers[kafka.CIDHeader], "client-cid")
+
+	// Handler logs through the request logger
+	entries := logs.FilterMessage("received createCompany request").All()
+	assert.Equal(t, len(entries), 1)
+
+	fields := entries[0].ContextMap()
+	assert.Equal(t, fields["cid"], "client-cid")
+	assert.Equal(t, fields["route"], "POST /v1/company/")
+	assert.Equal(t, fields["userId"], userID.String())
+
+	// Correlation id is generated if the client doesn't send one, and reported in the problem
+	req, _ = http.NewRequest("POST", "/v1/company/", bytes.NewBufferString("{}"))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	cid := w.Header().Get(middleware.CorrelationIDHeader)
+	assert.NotEqual(t, cid, "")
+
+	var p problem.Problem
+	err = json.Unmarshal(w.Body.Bytes(), &p)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, p.CorrelationID, cid)
+}
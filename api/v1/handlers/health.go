@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// HealthStatus represents the response of the health endpoint.
+type HealthStatus struct {
+	Status   string          `json:"status"`
+	Outbox   OutboxHealth    `json:"outbox"`
+	Producer *ProducerHealth `json:"producer,omitempty"`
+	Spool    *SpoolHealth    `json:"spool,omitempty"`
+}
+
+// OutboxHealth describes the messages waiting in the outbox to be published.
+type OutboxHealth struct {
+	Pending    int64   `json:"pending"`
+	LagSeconds float64 `json:"lagSeconds"`
+}
+
+// ProducerHealth describes the delivery of the messages sent by the Kafka producer.
+type ProducerHealth struct {
+	Sent     int64 `json:"sent"`
+	Failed   int64 `json:"failed"`
+	Spooled  int64 `json:"spooled"`
+	Buffered int64 `json:"buffered"`
+}
+
+// SpoolHealth describes the messages waiting in the Kafka spool to be replayed.
+type SpoolHealth struct {
+	Pending int64 `json:"pending"`
+}
+
+// HandleHealth handles the GET endpoint "/health".
+// It reports the number of outbox messages waiting to be published
+// and how long the oldest one has been waiting.
+// If the Kafka producer is set, its delivery counters are reported as well,
+// and if the Kafka spool is used, the number of spooled messages.
+func (h *RESTHandlers) HandleHealth(c *gin.Context) {
+	stats, err := h.store.OutboxStats()
+	if err != nil {
+		h.getLogger(c.Request.Context()).Error("error fetching outbox stats", zap.Error(err))
+
+		c.JSON(http.StatusServiceUnavailable, HealthStatus{Status: "unavailable"})
+
+		return
+	}
+
+	health := HealthStatus{
+		Status: "ok",
+		Outbox: OutboxHealth{
+			Pending:    stats.Pending,
+			LagSeconds: stats.Lag(time.Now()).Seconds(),
+		},
+	}
+
+	if h.producer != nil {
+		ps := h.producer.Stats()
+
+		health.Producer = &ProducerHealth{
+			Sent:     ps.Sent,
+			Failed:   ps.Failed,
+			Spooled:  ps.Spooled,
+			Buffered: ps.Buffered,
+		}
+	}
+
+	if h.spool != nil {
+		health.Spool = &SpoolHealth{Pending: h.spool.Depth()}
+	}
+
+	c.JSON(http.StatusOK, health)
+}
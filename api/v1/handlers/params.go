@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/problem"
+	"github.com/kperanovic/epam-systems/internal/storage"
+)
+
+const (
+	etagHeader    = "ETag"
+	ifMatchHeader = "If-Match"
+)
+
+// companyURI represents the path parameters of the "/v1/company/:id" endpoints.
+type companyURI struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+// bindCompanyID parses the company id from the path parameters.
+// If the id is not a valid UUID the request is aborted with 400
+// and false is returned, so the caller only needs to return.
+func bindCompanyID(c *gin.Context) (uuid.UUID, bool) {
+	var uri companyURI
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		problem.Abort(c, problem.FromBindingError(err, "invalid company id. Please check the request path"))
+
+		return uuid.Nil, false
+	}
+
+	// Validator already checked the format, so parsing can't fail here.
+	return uuid.MustParse(uri.ID), true
+}
+
+// idMismatch is the problem reported when the uuid in the request body
+// doesn't match the company id in the request path.
+func idMismatch() *problem.Problem {
+	return problem.BadRequest("invalid request. Please check the request body").
+		WithField("uuid", "eqfield", "must match the id in request path")
+}
+
+// etag returns the strong entity tag for the given company version.
+func etag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+// bindIfMatch parses the If-Match header into the expected company version.
+// Missing header and "*" match any version. Weak tags, unknown tags and lists
+// of tags are not supported, so the request is aborted with 412 and false is returned.
+func bindIfMatch(c *gin.Context) (int, bool) {
+	header := strings.TrimSpace(c.GetHeader(ifMatchHeader))
+	if header == "" || header == "*" {
+		return storage.AnyVersion, true
+	}
+
+	// Strong comparison is required for If-Match, weak tags never match.
+	unquoted, err := strconv.Unquote(header)
+	if err == nil {
+		version, err := strconv.Atoi(unquoted)
+		if err == nil && version > 0 {
+			return version, true
+		}
+	}
+
+	problem.Abort(c, problem.PreconditionFailed(fmt.Sprintf("entity tag %s doesn't match the company", header)))
+
+	return 0, false
+}
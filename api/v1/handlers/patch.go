@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/problem"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+	"github.com/kperanovic/epam-systems/internal/storage"
+)
+
+// Media types accepted by the PATCH endpoint.
+const (
+	// MergePatchContentType is the RFC 7396 JSON Merge Patch media type.
+	MergePatchContentType = "application/merge-patch+json"
+	// JSONPatchContentType is the RFC 6902 JSON Patch media type.
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// patcher applies a patch document to the JSON representation of a company.
+type patcher func(doc []byte) ([]byte, error)
+
+// newPatcher parses the patch document according to its media type.
+// Plain JSON (or missing content type) is treated as a merge patch.
+func newPatcher(contentType string, body []byte) (patcher, *problem.Problem) {
+	mediaType := MergePatchContentType
+	if contentType != "" {
+		mt, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, problem.UnsupportedMediaType(fmt.Sprintf("invalid content type %q", contentType))
+		}
+
+		mediaType = mt
+	}
+
+	switch mediaType {
+	case MergePatchContentType, binding.MIMEJSON:
+		if !json.Valid(body) {
+			return nil, problem.BadRequest("invalid request. Merge patch is not a valid JSON document")
+		}
+
+		return func(doc []byte) ([]byte, error) {
+			return jsonpatch.MergePatch(doc, body)
+		}, nil
+	case JSONPatchContentType:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, problem.BadRequest(fmt.Sprintf("invalid request. Malformed JSON patch: %s", err.Error()))
+		}
+
+		return patch.Apply, nil
+	default:
+		return nil, problem.UnsupportedMediaType(
+			fmt.Sprintf("content type %q is not supported. Use %q or %q", mediaType, MergePatchContentType, JSONPatchContentType),
+		)
+	}
+}
+
+// patchCompany returns the storage update function that applies the patch to the stored company.
+// The patched document has to be a valid CompanyRequest, otherwise the update is aborted with a problem.
+func patchCompany(id uuid.UUID, patch patcher) storage.UpdateFunc {
+	return func(company *types.Company) error {
+		doc, err := json.Marshal(company)
+		if err != nil {
+			return err
+		}
+
+		patched, err := patch(doc)
+		if err != nil {
+			return problem.Conflict(fmt.Sprintf("patch can't be applied to the current company: %s", err.Error()))
+		}
+
+		var req types.CompanyRequest
+
+		dec := json.NewDecoder(bytes.NewReader(patched))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			return problem.UnprocessableEntity(fmt.Sprintf("patched company is invalid: %s", err.Error()))
+		}
+
+		if err := binding.Validator.ValidateStruct(&req); err != nil {
+			return problem.FromBindingError(err, "patched company is invalid").WithStatus(http.StatusUnprocessableEntity)
+		}
+
+		if req.ID != id {
+			return idMismatch()
+		}
+
+		*company = *req.Company()
+
+		return nil
+	}
+}
@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	middleware "github.com/kperanovic/epam-systems/api/v1/auth"
+	"github.com/kperanovic/epam-systems/api/v1/problem"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/oauth"
+	"github.com/kperanovic/epam-systems/internal/refresh"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"github.com/kperanovic/epam-systems/internal/token"
+	"go.uber.org/zap"
+)
+
+// Token endpoint values defined by RFC 6749.
+const (
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeRefreshToken      = "refresh_token"
+	tokenTypeBearer            = "Bearer"
+
+	errInvalidRequest       = "invalid_request"
+	errInvalidClient        = "invalid_client"
+	errInvalidGrant         = "invalid_grant"
+	errInvalidScope         = "invalid_scope"
+	errUnsupportedGrantType = "unsupported_grant_type"
+)
+
+// ScopeRevoke allows revoking the tokens of other users.
+const ScopeRevoke = "auth:revoke"
+
+// TokenHandlers issue the access tokens to the registered OAuth2 clients.
+type TokenHandlers struct {
+	log     *zap.Logger
+	clients *oauth.Registry
+	token   token.Token
+	revoker Revoker
+	refresh *refresh.Manager
+}
+
+// errClientMismatch is returned when the refresh token was issued to another client.
+var errClientMismatch = errors.New("refresh token was issued to another client")
+
+// Revoker revokes the access tokens before their expiry. It is implemented by revocation.List.
+type Revoker interface {
+	Revoke(ctx context.Context, payload *token.Payload) error
+	RevokeUser(ctx context.Context, userID uuid.UUID) error
+}
+
+// NewTokenHandlers creates the token endpoint handlers.
+// Tokens are created with the given token.Token, so they are accepted by the AuthMiddleware.
+func NewTokenHandlers(log *zap.Logger, clients *oauth.Registry, t token.Token) *TokenHandlers {
+	return &TokenHandlers{
+		log:     log,
+		clients: clients,
+		token:   t,
+	}
+}
+
+// WithRevoker enables the token revocation endpoint.
+func (h *TokenHandlers) WithRevoker(revoker Revoker) *TokenHandlers {
+	h.revoker = revoker
+
+	return h
+}
+
+// WithRefreshTokens issues refresh tokens with the access tokens and enables the refresh_token grant.
+func (h *TokenHandlers) WithRefreshTokens(m *refresh.Manager) *TokenHandlers {
+	h.refresh = m
+
+	return h
+}
+
+// HandleToken handles the POST endpoint "/v1/auth/token".
+// It implements the OAuth2 client credentials grant (RFC 6749, section 4.4)
+// and, if refresh tokens are enabled, the refresh token grant (RFC 6749, section 6).
+func (h *TokenHandlers) HandleToken(c *gin.Context) {
+	// Token responses must not be cached (RFC 6749, section 5.1).
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	if c.ContentType() != binding.MIMEPOSTForm {
+		abortWithTokenError(c, http.StatusBadRequest, errInvalidRequest, "request body has to be "+binding.MIMEPOSTForm)
+
+		return
+	}
+
+	switch grantType := c.PostForm("grant_type"); {
+	case grantType == grantTypeClientCredentials:
+		h.clientCredentialsGrant(c)
+	case grantType == grantTypeRefreshToken && h.refresh != nil:
+		h.refreshTokenGrant(c)
+	case grantType == "":
+		abortWithTokenError(c, http.StatusBadRequest, errInvalidRequest, "grant_type is required")
+	default:
+		abortWithTokenError(c, http.StatusBadRequest, errUnsupportedGrantType, "grant type "+grantType+" is not supported")
+	}
+}
+
+// clientCredentialsGrant issues the access token to the authenticated client.
+// Client authenticates with the HTTP basic authorization header or with the
+// client_id and client_secret form parameters. Requested scopes are sent
+// in the scope parameter, all scopes allowed for the client are granted if it is missing.
+func (h *TokenHandlers) clientCredentialsGrant(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	scopes, err := client.Grant(strings.Fields(c.PostForm("scope")))
+	if err != nil {
+		abortWithTokenError(c, http.StatusBadRequest, errInvalidScope, err.Error())
+
+		return
+	}
+
+	var refreshToken string
+	if h.refresh != nil {
+		if refreshToken, err = h.refresh.Issue(c.Request.Context(), client.UserID(), client.Name, scopes); err != nil {
+			h.getLogger(c.Request.Context()).Error("error issuing refresh token", zap.String("clientId", client.ID), zap.Error(err))
+
+			problem.Abort(c, problem.Internal())
+
+			return
+		}
+	}
+
+	h.respondWithToken(c, client, scopes, refreshToken)
+}
+
+// refreshTokenGrant exchanges the refresh token for a new access token and rotates it.
+// Client has to authenticate and be the one the token was issued to,
+// so a stolen refresh token can't be used without the client secret.
+// Requested scopes can only narrow the scopes of the refresh token.
+func (h *TokenHandlers) refreshTokenGrant(c *gin.Context) {
+	raw := c.PostForm("refresh_token")
+	if raw == "" {
+		abortWithTokenError(c, http.StatusBadRequest, errInvalidRequest, "refresh_token is required")
+
+		return
+	}
+
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	log := h.getLogger(c.Request.Context())
+
+	rotation, err := h.refresh.Rotate(c.Request.Context(), raw, func(current *storage.RefreshToken) ([]string, error) {
+		if client.UserID() != current.UserID {
+			return nil, errClientMismatch
+		}
+
+		return grantRefresh(client, strings.Fields(current.Scope), strings.Fields(c.PostForm("scope")))
+	})
+
+	switch {
+	case errors.Is(err, oauth.ErrInvalidScope):
+		abortWithTokenError(c, http.StatusBadRequest, errInvalidScope, err.Error())
+
+		return
+	case errors.Is(err, refresh.ErrInvalidToken), errors.Is(err, refresh.ErrTokenReused), errors.Is(err, errClientMismatch):
+		abortWithTokenError(c, http.StatusBadRequest, errInvalidGrant, err.Error())
+
+		return
+	case err != nil:
+		log.Error("error rotating refresh token", zap.Error(err))
+
+		problem.Abort(c, problem.Internal())
+
+		return
+	}
+
+	h.respondWithToken(c, client, rotation.Scopes, rotation.Raw)
+}
+
+// authenticateClient authenticates the client with its credentials.
+// Response is rendered if the authentication fails.
+func (h *TokenHandlers) authenticateClient(c *gin.Context) (*oauth.Client, bool) {
+	id, secret, basic, err := clientCredentials(c)
+	if err != nil {
+		abortWithTokenError(c, http.StatusBadRequest, errInvalidRequest, err.Error())
+
+		return nil, false
+	}
+
+	client, err := h.clients.Authenticate(id, secret)
+	if err != nil {
+		h.getLogger(c.Request.Context()).Info("client authentication failed", zap.String("clientId", id))
+
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="token"`)
+		}
+
+		abortWithTokenError(c, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+
+		return nil, false
+	}
+
+	return client, true
+}
+
+// respondWithToken creates the access token for the client and renders the token response.
+func (h *TokenHandlers) respondWithToken(c *gin.Context, client *oauth.Client, scopes []string, refreshToken string) {
+	log := h.getLogger(c.Request.Context())
+
+	accessToken, err := h.token.CreateToken(client.UserID(), client.Name, client.TokenTTL, scopes...)
+	if err != nil {
+		log.Error("error creating access token", zap.String("clientId", client.ID), zap.Error(err))
+
+		problem.Abort(c, problem.Internal())
+
+		return
+	}
+
+	log.Info("issued access token", zap.String("clientId", client.ID), zap.Strings("scopes", scopes))
+
+	c.JSON(http.StatusOK, types.TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    tokenTypeBearer,
+		ExpiresIn:    int64(client.TokenTTL / time.Second),
+		Scope:        strings.Join(scopes, " "),
+		RefreshToken: refreshToken,
+	})
+}
+
+// HandleJWKS handles the GET endpoint "/.well-known/jwks.json".
+// It publishes the public keys the access tokens are verified with.
+// Key set is empty if the tokens are signed with a shared secret.
+func (h *TokenHandlers) HandleJWKS(c *gin.Context) {
+	jwks := token.JWKS{Keys: []token.JWK{}}
+	if keys, ok := h.token.(token.KeySet); ok {
+		jwks = keys.JWKS()
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwks)
+}
+
+// HandleRevoke handles the POST endpoint "/v1/auth/revoke", authenticated by the AuthMiddleware.
+// Without parameters it revokes the access token of the request (logout).
+// The token form parameter revokes the given access token, or the family of the given refresh token (RFC 7009).
+// Invalid and expired tokens are ignored. The user_id form parameter revokes every access and refresh token
+// issued to the user so far.
+// Tokens of other users can only be revoked with the ScopeRevoke scope.
+func (h *TokenHandlers) HandleRevoke(c *gin.Context) {
+	caller, ok := middleware.PayloadFromContext(c)
+	if !ok || h.revoker == nil {
+		problem.Abort(c, problem.Internal())
+
+		return
+	}
+
+	if c.Request.ContentLength != 0 && c.ContentType() != binding.MIMEPOSTForm {
+		problem.Abort(c, problem.UnsupportedMediaType("request body has to be "+binding.MIMEPOSTForm))
+
+		return
+	}
+
+	rawToken, rawUserID := c.PostForm("token"), c.PostForm("user_id")
+	if rawToken != "" && rawUserID != "" {
+		problem.Abort(c, problem.BadRequest("only one of token and user_id can be revoked at once"))
+
+		return
+	}
+
+	log := h.getLogger(c.Request.Context())
+
+	switch {
+	case rawUserID != "":
+		userID, err := uuid.Parse(rawUserID)
+		if err != nil {
+			problem.Abort(c, problem.BadRequest("user_id is not a valid uuid"))
+
+			return
+		}
+
+		if userID != caller.UserID && !caller.HasScope(ScopeRevoke) {
+			problem.Abort(c, problem.Forbidden("revoking tokens of other users requires the "+ScopeRevoke+" scope"))
+
+			return
+		}
+
+		if err := h.revoker.RevokeUser(c.Request.Context(), userID); err != nil {
+			log.Error("error revoking user tokens", zap.Stringer("revokedUserId", userID), zap.Error(err))
+
+			problem.Abort(c, problem.Internal())
+
+			return
+		}
+
+		if h.refresh != nil {
+			if err := h.refresh.RevokeUser(c.Request.Context(), userID); err != nil {
+				log.Error("error revoking user refresh tokens", zap.Stringer("revokedUserId", userID), zap.Error(err))
+
+				problem.Abort(c, problem.Internal())
+
+				return
+			}
+		}
+
+		log.Info("revoked user tokens", zap.Stringer("revokedUserId", userID))
+	default:
+		payload := caller
+
+		if rawToken != "" {
+			var err error
+			if payload, err = h.token.VerifyToken(rawToken); err != nil {
+				h.revokeRefreshToken(c, caller, rawToken)
+
+				return
+			}
+
+			if payload.UserID != caller.UserID && !caller.HasScope(ScopeRevoke) {
+				problem.Abort(c, problem.Forbidden("revoking tokens of other users requires the "+ScopeRevoke+" scope"))
+
+				return
+			}
+		}
+
+		if err := h.revoker.Revoke(c.Request.Context(), payload); err != nil {
+			log.Error("error revoking token", zap.Stringer("tokenId", payload.ID), zap.Error(err))
+
+			problem.Abort(c, problem.Internal())
+
+			return
+		}
+
+		log.Info("revoked token", zap.Stringer("tokenId", payload.ID))
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// revokeRefreshToken revokes the family of the refresh token.
+// Tokens which are neither valid access nor refresh tokens are ignored (RFC 7009, section 2.2).
+func (h *TokenHandlers) revokeRefreshToken(c *gin.Context, caller *token.Payload, raw string) {
+	if h.refresh == nil {
+		c.Status(http.StatusOK)
+
+		return
+	}
+
+	log := h.getLogger(c.Request.Context())
+
+	refreshToken, err := h.refresh.Lookup(c.Request.Context(), raw)
+	if errors.Is(err, refresh.ErrInvalidToken) {
+		c.Status(http.StatusOK)
+
+		return
+	}
+
+	if err != nil {
+		log.Error("error looking up refresh token", zap.Error(err))
+
+		problem.Abort(c, problem.Internal())
+
+		return
+	}
+
+	if refreshToken.UserID != caller.UserID && !caller.HasScope(ScopeRevoke) {
+		problem.Abort(c, problem.Forbidden("revoking tokens of other users requires the "+ScopeRevoke+" scope"))
+
+		return
+	}
+
+	if err := h.refresh.RevokeFamily(c.Request.Context(), refreshToken); err != nil {
+		log.Error("error revoking refresh token", zap.Stringer("familyId", refreshToken.FamilyID), zap.Error(err))
+
+		problem.Abort(c, problem.Internal())
+
+		return
+	}
+
+	log.Info("revoked refresh token family", zap.Stringer("familyId", refreshToken.FamilyID))
+
+	c.Status(http.StatusOK)
+}
+
+// getLogger returns the request logger set by the middleware or the instance logger.
+func (h *TokenHandlers) getLogger(ctx context.Context) *zap.Logger {
+	if log := logger.FromContext(ctx); log != nil {
+		return log
+	}
+
+	return h.log
+}
+
+// grantRefresh returns the scopes of the access token issued for the refresh token.
+// Requested scopes have to be granted to the refresh token, which are all granted if none is requested.
+// Scopes which are no longer allowed for the client are rejected.
+func grantRefresh(client *oauth.Client, granted, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		requested = granted
+	}
+
+	for _, scope := range requested {
+		if !containsScope(granted, scope) {
+			return nil, fmt.Errorf("%w: %s", oauth.ErrInvalidScope, scope)
+		}
+	}
+
+	if len(requested) == 0 {
+		return nil, nil
+	}
+
+	return client.Grant(requested)
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientCredentials returns the client id and secret and whether they were sent in the basic authorization header.
+// Client can't use both authentication methods at once.
+func clientCredentials(c *gin.Context) (id, secret string, basic bool, err error) {
+	id, secret, basic = c.Request.BasicAuth()
+	if !basic {
+		return c.PostForm("client_id"), c.PostForm("client_secret"), false, nil
+	}
+
+	if c.PostForm("client_secret") != "" {
+		return "", "", true, errors.New("client has to authenticate with a single method")
+	}
+
+	// Basic credentials are form encoded (RFC 6749, section 2.3.1).
+	if id, err = url.QueryUnescape(id); err != nil {
+		return "", "", true, errors.New("invalid client id encoding")
+	}
+
+	if secret, err = url.QueryUnescape(secret); err != nil {
+		return "", "", true, errors.New("invalid client secret encoding")
+	}
+
+	return id, secret, true, nil
+}
+
+// abortWithTokenError renders the OAuth2 error response and aborts the request.
+func abortWithTokenError(c *gin.Context, status int, code, description string) {
+	c.AbortWithStatusJSON(status, types.TokenError{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
@@ -0,0 +1,531 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+	middleware "github.com/kperanovic/epam-systems/api/v1/auth"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/oauth"
+	"github.com/kperanovic/epam-systems/internal/refresh"
+	"github.com/kperanovic/epam-systems/internal/revocation"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"github.com/kperanovic/epam-systems/internal/token"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTokenHandlers_HandleToken(t *testing.T) {
+	// Define new gin router
+	r := GinRouter()
+
+	clientID := "9b2f6a3e-58a4-4a8e-9d55-3f0d7f1c2b61"
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret&"), bcrypt.MinCost)
+	assert.Equal(t, err, nil)
+
+	clients, err := oauth.NewRegistry([]oauth.Client{{
+		ID:         clientID,
+		Name:       "reporting",
+		SecretHash: string(hash),
+		Scopes:     []string{"company:read", "company:write"},
+		TokenTTL:   5 * time.Minute,
+	}}, 0)
+	assert.Equal(t, err, nil)
+
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	h := NewTokenHandlers(logger.NewDevelopment(), clients, j)
+	r.POST("/v1/auth/token", h.HandleToken)
+
+	tests := []struct {
+		name        string
+		contentType string
+		form        url.Values
+		// basic holds the id and secret sent in the authorization header, if set.
+		basic      []string
+		wantStatus int
+		wantError  string
+		wantScope  string
+	}{
+		{
+			name:       "Test basic authentication",
+			form:       url.Values{"grant_type": {"client_credentials"}},
+			basic:      []string{clientID, url.QueryEscape("s3cret&")},
+			wantStatus: http.StatusOK,
+			wantScope:  "company:read company:write",
+		},
+		{
+			name: "Test form authentication with requested scope",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {clientID},
+				"client_secret": {"s3cret&"},
+				"scope":         {"company:read"},
+			},
+			wantStatus: http.StatusOK,
+			wantScope:  "company:read",
+		},
+		{
+			name:       "Test wrong secret",
+			form:       url.Values{"grant_type": {"client_credentials"}},
+			basic:      []string{clientID, "wrong"},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid_client",
+		},
+		{
+			name: "Test unknown client",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {"reporting"},
+				"client_secret": {"s3cret&"},
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid_client",
+		},
+		{
+			name: "Test scope which isn't allowed",
+			form: url.Values{
+				"grant_type": {"client_credentials"},
+				"scope":      {"company:read company:admin"},
+			},
+			basic:      []string{clientID, url.QueryEscape("s3cret&")},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_scope",
+		},
+		{
+			name:       "Test unsupported grant type",
+			form:       url.Values{"grant_type": {"password"}},
+			basic:      []string{clientID, url.QueryEscape("s3cret&")},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "unsupported_grant_type",
+		},
+		{
+			name: "Test both authentication methods",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_secret": {"s3cret&"},
+			},
+			basic:      []string{clientID, url.QueryEscape("s3cret&")},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_request",
+		},
+		{
+			name:        "Test JSON body",
+			contentType: "application/json",
+			form:        url.Values{"grant_type": {"client_credentials"}},
+			basic:       []string{clientID, url.QueryEscape("s3cret&")},
+			wantStatus:  http.StatusBadRequest,
+			wantError:   "invalid_request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/v1/auth/token", strings.NewReader(tt.form.Encode()))
+
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/x-www-form-urlencoded"
+			}
+			req.Header.Set("Content-Type", contentType)
+
+			if tt.basic != nil {
+				req.SetBasicAuth(tt.basic[0], tt.basic[1])
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, w.Code, tt.wantStatus)
+			assert.Equal(t, w.Header().Get("Cache-Control"), "no-store")
+
+			if tt.wantError != "" {
+				var resp types.TokenError
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.Equal(t, err, nil)
+				assert.Equal(t, resp.Error, tt.wantError)
+
+				return
+			}
+
+			var resp types.TokenResponse
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, resp.TokenType, "Bearer")
+			assert.Equal(t, resp.ExpiresIn, int64(300))
+			assert.Equal(t, resp.Scope, tt.wantScope)
+
+			// Issued token is accepted by the auth middleware
+			payload, err := j.VerifyToken(resp.AccessToken)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, payload.UserID.String(), clientID)
+			assert.Equal(t, payload.Name, "reporting")
+			assert.Equal(t, payload.Scope, tt.wantScope)
+		})
+	}
+}
+
+func TestTokenHandlers_HandleJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Equal(t, err, nil)
+
+	keyPair, err := token.NewKeyPairToken(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.Equal(t, err, nil)
+
+	secret, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	clients, err := oauth.NewRegistry(nil, 0)
+	assert.Equal(t, err, nil)
+
+	tests := []struct {
+		name     string
+		token    token.Token
+		wantKeys []token.JWK
+	}{
+		{
+			name:     "Test key pair publishes its public key",
+			token:    keyPair,
+			wantKeys: keyPair.JWKS().Keys,
+		},
+		{
+			name:     "Test shared secret publishes no keys",
+			token:    secret,
+			wantKeys: []token.JWK{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Define new gin router
+			r := GinRouter()
+
+			h := NewTokenHandlers(logger.NewDevelopment(), clients, tt.token)
+			r.GET("/.well-known/jwks.json", h.HandleJWKS)
+
+			req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, w.Code, http.StatusOK)
+
+			var jwks token.JWKS
+			err := json.Unmarshal(w.Body.Bytes(), &jwks)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, jwks.Keys, tt.wantKeys)
+		})
+	}
+}
+
+func TestTokenHandlers_HandleRevoke(t *testing.T) {
+	// Define new gin router
+	r := GinRouter()
+
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	clients, err := oauth.NewRegistry(nil, 0)
+	assert.Equal(t, err, nil)
+
+	revoked := revocation.NewList(logger.NewDevelopment(), storage.NewMemoryStorage(), time.Hour, 0)
+	auth := middleware.AuthMiddleware(j, revoked)
+
+	h := NewTokenHandlers(logger.NewDevelopment(), clients, j).WithRevoker(revoked)
+	r.POST("/v1/auth/revoke", auth, h.HandleRevoke)
+	r.GET("/protected", auth, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		scopes []string
+		// otherUser makes the other token belong to another user than the caller.
+		otherUser bool
+		// form builds the request form from the other token and its user id.
+		form              func(other string, otherID uuid.UUID) url.Values
+		wantStatus        int
+		wantCallerRevoked bool
+		wantOtherRevoked  bool
+	}{
+		{
+			name:              "Test logout",
+			form:              func(string, uuid.UUID) url.Values { return nil },
+			wantStatus:        http.StatusOK,
+			wantCallerRevoked: true,
+		},
+		{
+			name:             "Test revoke another token of the user",
+			form:             func(other string, _ uuid.UUID) url.Values { return url.Values{"token": {other}} },
+			wantStatus:       http.StatusOK,
+			wantOtherRevoked: true,
+		},
+		{
+			name:       "Test revoke token of another user",
+			otherUser:  true,
+			form:       func(other string, _ uuid.UUID) url.Values { return url.Values{"token": {other}} },
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:             "Test revoke token of another user with the revoke scope",
+			scopes:           []string{ScopeRevoke},
+			otherUser:        true,
+			form:             func(other string, _ uuid.UUID) url.Values { return url.Values{"token": {other}} },
+			wantStatus:       http.StatusOK,
+			wantOtherRevoked: true,
+		},
+		{
+			name:       "Test revoke invalid token",
+			form:       func(string, uuid.UUID) url.Values { return url.Values{"token": {"invalid"}} },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:              "Test revoke all tokens of the user",
+			form:              func(_ string, id uuid.UUID) url.Values { return url.Values{"user_id": {id.String()}} },
+			wantStatus:        http.StatusOK,
+			wantCallerRevoked: true,
+			wantOtherRevoked:  true,
+		},
+		{
+			name:       "Test revoke all tokens of another user",
+			otherUser:  true,
+			form:       func(_ string, id uuid.UUID) url.Values { return url.Values{"user_id": {id.String()}} },
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:             "Test revoke all tokens of another user with the revoke scope",
+			scopes:           []string{ScopeRevoke},
+			otherUser:        true,
+			form:             func(_ string, id uuid.UUID) url.Values { return url.Values{"user_id": {id.String()}} },
+			wantStatus:       http.StatusOK,
+			wantOtherRevoked: true,
+		},
+		{
+			name:       "Test invalid user id",
+			form:       func(string, uuid.UUID) url.Values { return url.Values{"user_id": {"invalid"}} },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Test token and user id",
+			form: func(other string, id uuid.UUID) url.Values {
+				return url.Values{"token": {other}, "user_id": {id.String()}}
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callerID, otherID := uuid.New(), uuid.New()
+			if !tt.otherUser {
+				otherID = callerID
+			}
+
+			caller, err := j.CreateToken(callerID, "caller", time.Minute, tt.scopes...)
+			assert.Equal(t, err, nil)
+
+			other, err := j.CreateToken(otherID, "other", time.Minute)
+			assert.Equal(t, err, nil)
+
+			req, _ := http.NewRequest("POST", "/v1/auth/revoke", strings.NewReader(tt.form(other, otherID).Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Authorization", "Bearer "+caller)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, w.Code, tt.wantStatus)
+
+			// Revoked tokens are rejected by the auth middleware
+			for token, wantRevoked := range map[string]bool{caller: tt.wantCallerRevoked, other: tt.wantOtherRevoked} {
+				req, _ := http.NewRequest("GET", "/protected", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				assert.Equal(t, w.Code == http.StatusUnauthorized, wantRevoked)
+			}
+		})
+	}
+}
+
+func TestTokenHandlers_HandleToken_Refresh(t *testing.T) {
+	// Define new gin router
+	r := GinRouter()
+
+	clientID, otherID := "9b2f6a3e-58a4-4a8e-9d55-3f0d7f1c2b61", "6f0e2d8c-0a51-4c39-bb1e-2a9a3c6d7e80"
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	assert.Equal(t, err, nil)
+
+	clients, err := oauth.NewRegistry([]oauth.Client{
+		{ID: clientID, Name: "reporting", SecretHash: string(hash), Scopes: []string{"company:read", "company:write"}},
+		{ID: otherID, Name: "audit", SecretHash: string(hash), Scopes: []string{"company:read"}},
+	}, 0)
+	assert.Equal(t, err, nil)
+
+	j, err := token.NewJWTToken("KLguRWx03zXcWwDXywrxgwTS7r39QaF1")
+	assert.Equal(t, err, nil)
+
+	store := storage.NewMemoryStorage()
+	revoked := revocation.NewList(logger.NewDevelopment(), store, time.Hour, 0)
+
+	h := NewTokenHandlers(logger.NewDevelopment(), clients, j).
+		WithRevoker(revoked).
+		WithRefreshTokens(refresh.NewManager(logger.NewDevelopment(), store, time.Hour, 0).WithRevoker(revoked))
+	auth := middleware.AuthMiddleware(j, revoked)
+	r.POST("/v1/auth/token", h.HandleToken)
+	r.POST("/v1/auth/revoke", auth, h.HandleRevoke)
+	r.GET("/protected", auth, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// post sends the form to the endpoint and decodes the token response or error into resp
+	post := func(path string, form url.Values, bearer string, resp interface{}) int {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if resp != nil {
+			err := json.Unmarshal(w.Body.Bytes(), resp)
+			assert.Equal(t, err, nil)
+		}
+
+		return w.Code
+	}
+
+	// refreshGrant authenticates the client unless the extra values override the credentials
+	refreshGrant := func(refreshToken string, extra url.Values) url.Values {
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+			"client_id":     {clientID},
+			"client_secret": {"s3cret"},
+		}
+		for k, v := range extra {
+			form[k] = v
+		}
+
+		return form
+	}
+
+	// Client credentials grant issues the refresh token
+	var issued types.TokenResponse
+	code := post("/v1/auth/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {"s3cret"},
+	}, "", &issued)
+	assert.Equal(t, code, http.StatusOK)
+	assert.NotEqual(t, issued.RefreshToken, "")
+
+	// Refresh token is exchanged and rotated
+	var refreshed types.TokenResponse
+	code = post("/v1/auth/token", refreshGrant(issued.RefreshToken, url.Values{"scope": {"company:read"}}), "", &refreshed)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, refreshed.Scope, "company:read")
+	assert.NotEqual(t, refreshed.RefreshToken, "")
+	assert.NotEqual(t, refreshed.RefreshToken, issued.RefreshToken)
+
+	payload, err := j.VerifyToken(refreshed.AccessToken)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, payload.UserID.String(), clientID)
+	assert.Equal(t, payload.Name, "reporting")
+
+	// Narrowed access token scope doesn't narrow the refresh token
+	var full types.TokenResponse
+	code = post("/v1/auth/token", refreshGrant(refreshed.RefreshToken, nil), "", &full)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, full.Scope, "company:read company:write")
+
+	var tokenErr types.TokenError
+
+	// Scopes beyond the refresh token are rejected and the token isn't spent
+	code = post("/v1/auth/token", refreshGrant(full.RefreshToken, url.Values{"scope": {"company:admin"}}), "", &tokenErr)
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, tokenErr.Error, "invalid_scope")
+
+	// Client has to authenticate
+	code = post("/v1/auth/token", refreshGrant(full.RefreshToken, url.Values{"client_id": nil, "client_secret": nil}), "", &tokenErr)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.Equal(t, tokenErr.Error, "invalid_client")
+
+	// Authenticated client has to be the one the token was issued to
+	code = post("/v1/auth/token", refreshGrant(full.RefreshToken, url.Values{
+		"client_id":     {otherID},
+		"client_secret": {"s3cret"},
+	}), "", &tokenErr)
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, tokenErr.Error, "invalid_grant")
+
+	code = post("/v1/auth/token", refreshGrant("", nil), "", &tokenErr)
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, tokenErr.Error, "invalid_request")
+
+	// Access token issued from the family is valid until the reuse
+	get := func(bearer string) int {
+		req, _ := http.NewRequest("GET", "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w.Code
+	}
+	assert.Equal(t, get(full.AccessToken), http.StatusOK)
+
+	// Reuse of a spent token revokes the whole family and its access tokens
+	code = post("/v1/auth/token", refreshGrant(issued.RefreshToken, nil), "", &tokenErr)
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, tokenErr.Error, "invalid_grant")
+
+	code = post("/v1/auth/token", refreshGrant(full.RefreshToken, nil), "", &tokenErr)
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, tokenErr.Error, "invalid_grant")
+
+	assert.Equal(t, get(full.AccessToken), http.StatusUnauthorized)
+
+	// Refresh token family is revoked with the revocation endpoint
+	code = post("/v1/auth/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {"s3cret"},
+	}, "", &issued)
+	assert.Equal(t, code, http.StatusOK)
+
+	code = post("/v1/auth/revoke", url.Values{"token": {issued.RefreshToken}}, issued.AccessToken, nil)
+	assert.Equal(t, code, http.StatusOK)
+
+	code = post("/v1/auth/token", refreshGrant(issued.RefreshToken, nil), "", &tokenErr)
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, tokenErr.Error, "invalid_grant")
+
+	// Revoking the user revokes its refresh tokens as well
+	code = post("/v1/auth/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {"s3cret"},
+	}, "", &issued)
+	assert.Equal(t, code, http.StatusOK)
+
+	code = post("/v1/auth/revoke", url.Values{"user_id": {clientID}}, issued.AccessToken, nil)
+	assert.Equal(t, code, http.StatusOK)
+
+	code = post("/v1/auth/token", refreshGrant(issued.RefreshToken, nil), "", &tokenErr)
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, tokenErr.Error, "invalid_grant")
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var registerOnce sync.Once
+
+// registerValidations configures the gin validator engine.
+// Field errors are reported with the name the client used (json, form or uri tag)
+// instead of the Go struct field name.
+func registerValidations() {
+	registerOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			for _, tag := range []string{"json", "form", "uri"} {
+				name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+				if name == "-" {
+					return ""
+				}
+
+				if name != "" {
+					return name
+				}
+			}
+
+			return f.Name
+		})
+	})
+}
@@ -0,0 +1,200 @@
+// Package problem implements the RFC 7807 "Problem Details for HTTP APIs"
+// error model. Every error returned by the REST API is rendered
+// as a Problem with the "application/problem+json" content type.
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/kperanovic/epam-systems/internal/cid"
+)
+
+// ContentType is the media type used for problem responses.
+const ContentType = "application/problem+json"
+
+// Problem types returned by the API.
+// Types are relative URI references as allowed by the RFC.
+const (
+	TypeDefault      = "about:blank"
+	TypeValidation   = "/problems/validation-error"
+	TypeNotFound     = "/problems/not-found"
+	TypeConflict     = "/problems/conflict"
+	TypeUnsupported  = "/problems/unsupported-media-type"
+	TypePrecondition = "/problems/precondition-failed"
+	TypeUnauthorized = "/problems/unauthorized"
+	TypeForbidden    = "/problems/forbidden"
+)
+
+// Problem represents the RFC 7807 problem details object.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Instance identifies the specific occurrence of the problem, in this case the request path.
+	Instance string `json:"instance,omitempty"`
+	// Errors holds a breakdown of invalid request fields.
+	Errors        []FieldError `json:"errors,omitempty"`
+	CorrelationID string       `json:"correlationId,omitempty"`
+}
+
+// FieldError describes a single invalid field in the request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// New creates a new Problem of the given type and status.
+// Title is set to the standard status text.
+func New(typ string, status int, detail string) *Problem {
+	return &Problem{
+		Type:   typ,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error implements the error interface.
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%d %s: %s", p.Status, p.Title, p.Detail)
+}
+
+// WithField adds a field error to the problem and returns it.
+func (p *Problem) WithField(field, rule, message string) *Problem {
+	p.Errors = append(p.Errors, FieldError{
+		Field:   field,
+		Rule:    rule,
+		Message: message,
+	})
+
+	return p
+}
+
+// WithStatus changes the status of the problem and returns it.
+// Title is updated to match the new status.
+func (p *Problem) WithStatus(status int) *Problem {
+	p.Status = status
+	p.Title = http.StatusText(status)
+
+	return p
+}
+
+// BadRequest creates a new 400 validation problem.
+func BadRequest(detail string) *Problem {
+	return New(TypeValidation, http.StatusBadRequest, detail)
+}
+
+// Unauthorized creates a new 401 problem.
+func Unauthorized(detail string) *Problem {
+	return New(TypeUnauthorized, http.StatusUnauthorized, detail)
+}
+
+// Forbidden creates a new 403 problem.
+func Forbidden(detail string) *Problem {
+	return New(TypeForbidden, http.StatusForbidden, detail)
+}
+
+// NotFound creates a new 404 problem.
+func NotFound(detail string) *Problem {
+	return New(TypeNotFound, http.StatusNotFound, detail)
+}
+
+// Conflict creates a new 409 problem.
+func Conflict(detail string) *Problem {
+	return New(TypeConflict, http.StatusConflict, detail)
+}
+
+// PreconditionFailed creates a new 412 problem.
+func PreconditionFailed(detail string) *Problem {
+	return New(TypePrecondition, http.StatusPreconditionFailed, detail)
+}
+
+// UnsupportedMediaType creates a new 415 problem.
+func UnsupportedMediaType(detail string) *Problem {
+	return New(TypeUnsupported, http.StatusUnsupportedMediaType, detail)
+}
+
+// UnprocessableEntity creates a new 422 validation problem.
+func UnprocessableEntity(detail string) *Problem {
+	return New(TypeValidation, http.StatusUnprocessableEntity, detail)
+}
+
+// Internal creates a new 500 problem.
+// Detail is intentionally generic so internal errors don't leak to the client.
+func Internal() *Problem {
+	return New(TypeDefault, http.StatusInternalServerError, "error occured while processing request")
+}
+
+// FromBindingError creates a 400 problem from the error returned by gin binding.
+// Validator errors are broken down per field, other errors
+// (e.g. malformed JSON) are reported in the detail.
+func FromBindingError(err error, detail string) *Problem {
+	p := BadRequest(detail)
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		p.Detail = fmt.Sprintf("%s: %s", detail, err.Error())
+
+		return p
+	}
+
+	for _, fe := range verrs {
+		p.WithField(fe.Field(), fe.Tag(), fieldMessage(fe))
+	}
+
+	return p
+}
+
+// fieldMessage returns a human readable message for the validator error.
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "field is required"
+	case "max":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "min":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of [%s]", fe.Param())
+	case "uuid":
+		return "must be a valid UUID"
+	default:
+		return fmt.Sprintf("failed on the %q rule", fe.Tag())
+	}
+}
+
+// Abort renders the problem as the response and aborts the request.
+// Instance and correlation id are filled in from the request.
+// Correlation id is left out if the request context doesn't carry one.
+func Abort(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+
+	if p.CorrelationID == "" {
+		p.CorrelationID = cid.FromContext(c.Request.Context())
+	}
+
+	// Render only sets the JSON content type if it is not already set.
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Recovery returns a middleware that recovers from panics
+// and renders a 500 problem instead of an empty response.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		Abort(c, Internal())
+	})
+}
+
+// NoRoute renders a 404 problem for unknown routes.
+func NoRoute(c *gin.Context) {
+	Abort(c, NotFound("route not found"))
+}
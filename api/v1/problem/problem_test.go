@@ -0,0 +1,72 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/assert/v2"
+	"github.com/kperanovic/epam-systems/internal/cid"
+)
+
+func TestFromBindingError(t *testing.T) {
+	type request struct {
+		Name string `binding:"required,max=5"`
+	}
+
+	// Validator errors are broken down per field
+	err := binding.Validator.ValidateStruct(&request{Name: "too long name"})
+	assert.NotEqual(t, err, nil)
+
+	p := FromBindingError(err, "invalid request")
+	assert.Equal(t, p.Status, http.StatusBadRequest)
+	assert.Equal(t, p.Type, TypeValidation)
+	assert.Equal(t, p.Detail, "invalid request")
+	assert.Equal(t, len(p.Errors), 1)
+	assert.Equal(t, p.Errors[0].Field, "Name")
+	assert.Equal(t, p.Errors[0].Rule, "max")
+
+	// Other errors are reported in the detail
+	p = FromBindingError(&json.SyntaxError{}, "invalid request")
+	assert.Equal(t, p.Status, http.StatusBadRequest)
+	assert.Equal(t, len(p.Errors), 0)
+	assert.NotEqual(t, p.Detail, "invalid request")
+}
+
+func TestAbort(t *testing.T) {
+	r := gin.New()
+	r.GET("/problem", func(c *gin.Context) {
+		Abort(c, NotFound("company not found"))
+	})
+
+	req, _ := http.NewRequest("GET", "/problem", nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, w.Code, http.StatusNotFound)
+	assert.Equal(t, w.Header().Get("Content-Type"), ContentType)
+
+	var got Problem
+	err := json.Unmarshal(w.Body.Bytes(), &got)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, got.Type, TypeNotFound)
+	assert.Equal(t, got.Title, "Not Found")
+	assert.Equal(t, got.Status, http.StatusNotFound)
+	assert.Equal(t, got.Detail, "company not found")
+	assert.Equal(t, got.Instance, "/problem")
+	assert.Equal(t, got.CorrelationID, "")
+
+	// Correlation id of the request is reported
+	ctx := cid.WithContext(req.Context(), "test-cid")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req.WithContext(ctx))
+
+	err = json.Unmarshal(w.Body.Bytes(), &got)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, got.CorrelationID, "test-cid")
+}
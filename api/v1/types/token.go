@@ -0,0 +1,20 @@
+package types
+
+// TokenResponse is the access token response of the token endpoint (RFC 6749, section 5.1).
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+	// Scope is the space separated list of the granted scopes.
+	Scope string `json:"scope,omitempty"`
+	// RefreshToken is exchanged for a new access token with the refresh_token grant.
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// TokenError is the error response of the token endpoint (RFC 6749, section 5.2).
+// Token endpoint errors don't use the problem details format, since OAuth2 clients expect this one.
+type TokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
@@ -2,15 +2,54 @@ package types
 
 import "github.com/google/uuid"
 
-// Company represents the data structure for REST API.
+// Company represents the data structure for REST API responses.
 // Also structure is used as a schema for storage table.
+// Request bodies are bound to CompanyRequest instead.
 type Company struct {
-	ID          uuid.UUID `json:"uuid" binding:"required" gorm:"primaryKey"`
-	Name        string    `json:"name" binding:"required,max=15" gorm:"size:15"`
-	Description string    `json:"description" binding:"max=3000" gorm:"size:3000"`
-	Employees   int       `json:"employees" binding:"required" gorm:"type:int"`
-	Registered  bool      `json:"registered" binding:"required"`
-	CompanyType int       `json:"companyType" binding:"required" gorm:"size:1"`
+	ID          uuid.UUID `json:"uuid" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"size:15"`
+	Description string    `json:"description" gorm:"size:3000"`
+	Employees   int       `json:"employees" gorm:"type:int"`
+	Registered  bool      `json:"registered"`
+	CompanyType int       `json:"companyType" gorm:"size:1"`
+	// Version is incremented on every update and is used for optimistic concurrency control.
+	// It is sent to the client in the ETag header instead of the body.
+	Version int `json:"-" gorm:"not null;default:1"`
+}
+
+// CompanyRequest represents the request body used to create or replace a company.
+// Employees, Registered and CompanyType are pointers so that zero values
+// (0 and false) can be told apart from missing fields by the "required" rule.
+type CompanyRequest struct {
+	ID          uuid.UUID `json:"uuid" binding:"required"`
+	Name        string    `json:"name" binding:"required,max=15"`
+	Description string    `json:"description" binding:"max=3000"`
+	Employees   *int      `json:"employees" binding:"required,min=0"`
+	Registered  *bool     `json:"registered" binding:"required"`
+	CompanyType *int      `json:"companyType" binding:"required,min=0"`
+}
+
+// Company converts the validated request to a Company.
+func (r *CompanyRequest) Company() *Company {
+	company := &Company{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+	}
+
+	if r.Employees != nil {
+		company.Employees = *r.Employees
+	}
+
+	if r.Registered != nil {
+		company.Registered = *r.Registered
+	}
+
+	if r.CompanyType != nil {
+		company.CompanyType = *r.CompanyType
+	}
+
+	return company
 }
 
 type CompanyType struct {
@@ -19,3 +58,37 @@ type CompanyType struct {
 	// NOTE: I was unable to add the foreign key wih the gorm.Automigrate(). Needs more attention.
 	// Company Company `gorm:"foreignKey:CompanyType;references:ID;constraint:OnUpdate:RESTRICT,OnDelete:RESTRICT;"`
 }
+
+// ListCompaniesQuery represents the query parameters of the company list endpoint.
+type ListCompaniesQuery struct {
+	Name         string `form:"name" binding:"max=15"`
+	CompanyType  *int   `form:"companyType"`
+	Registered   *bool  `form:"registered"`
+	MinEmployees *int   `form:"minEmployees" binding:"omitempty,min=0"`
+	MaxEmployees *int   `form:"maxEmployees" binding:"omitempty,min=0"`
+	Sort         string `form:"sort" binding:"omitempty,oneof=name -name employees -employees"`
+	Limit        int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor       string `form:"cursor"`
+}
+
+// CompanyList represents a single page of companies.
+// NextCursor is omitted on the last page.
+type CompanyList struct {
+	Companies  []*Company `json:"companies"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// UpdateCompanyCommand represents the payload of the update company Kafka command.
+// The company is replaced with the given one. If Version is set,
+// company is only replaced if the stored version matches.
+type UpdateCompanyCommand struct {
+	Version int            `json:"version" binding:"min=0"`
+	Company CompanyRequest `json:"company"`
+}
+
+// DeleteCompanyCommand represents the payload of the delete company Kafka command.
+// If Version is set, company is only deleted if the stored version matches.
+type DeleteCompanyCommand struct {
+	ID      uuid.UUID `json:"uuid" binding:"required"`
+	Version int       `json:"version" binding:"min=0"`
+}
@@ -0,0 +1,169 @@
+package kafka
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+	"go.uber.org/zap"
+)
+
+// ProducerStats are the delivery counters of the producer.
+type ProducerStats struct {
+	// Sent is the number of messages acknowledged by the broker.
+	Sent int64
+	// Failed is the number of messages which could not be delivered.
+	Failed int64
+	// Spooled is the number of failed messages written to the spool.
+	Spooled int64
+	// Buffered is the number of messages waiting for the acknowledgement in async mode.
+	Buffered int64
+}
+
+type producerStats struct {
+	sent    atomic.Int64
+	failed  atomic.Int64
+	spooled atomic.Int64
+}
+
+// Stats returns the current delivery counters of the producer.
+func (p *Producer) Stats() ProducerStats {
+	return ProducerStats{
+		Sent:     p.stats.sent.Load(),
+		Failed:   p.stats.failed.Load(),
+		Spooled:  p.stats.spooled.Load(),
+		Buffered: int64(len(p.inflight)),
+	}
+}
+
+// enqueue buffers the message in the async producer.
+// It blocks while the buffer is full or until the context is done.
+func (p *Producer) enqueue(ctx context.Context, msg *sarama.ProducerMessage) error {
+	select {
+	case p.inflight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case p.async.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		<-p.inflight
+		return ctx.Err()
+	}
+}
+
+// handleSuccesses reports the acknowledged messages until the async producer is closed.
+func (p *Producer) handleSuccesses() {
+	defer p.wg.Done()
+
+	for m := range p.async.Successes() {
+		<-p.inflight
+
+		meta := m.Metadata.(*produced)
+		sent := meta.msg
+		p.stats.sent.Add(1)
+		endSpan(meta.span, m.Partition, m.Offset, nil)
+
+		p.log.Debug("message sent",
+			zap.String("cid", sent.Headers[CIDHeader]),
+			zap.String("topic", m.Topic),
+			zap.Int32("partition", m.Partition),
+			zap.Int64("offset", m.Offset),
+		)
+
+		p.onSuccess(sent, m.Partition, m.Offset)
+
+		if meta.acked != nil {
+			meta.acked <- nil
+		}
+	}
+}
+
+// handleErrors reports the failed messages until the async producer is closed.
+// Messages nobody waits for are written to the spool.
+func (p *Producer) handleErrors() {
+	defer p.wg.Done()
+
+	for perr := range p.async.Errors() {
+		<-p.inflight
+
+		meta := perr.Msg.Metadata.(*produced)
+		sent := meta.msg
+		p.stats.failed.Add(1)
+		endSpan(meta.span, 0, 0, perr.Err)
+
+		log := p.log.With(zap.String("cid", sent.Headers[CIDHeader]), zap.String("topic", perr.Msg.Topic))
+		log.Error("error sending message", zap.Error(perr.Err))
+
+		if meta.acked == nil && p.spool != nil {
+			if err := p.spool.Append(sent, perr.Err); err != nil {
+				log.Error("error spooling message", zap.Error(err))
+			} else {
+				p.stats.spooled.Add(1)
+			}
+		}
+
+		p.onError(sent, perr.Err)
+
+		if meta.acked != nil {
+			meta.acked <- perr.Err
+		}
+	}
+}
+
+// publishAcked buffers the messages in the async producer and waits until the broker acknowledges them.
+// It returns the number of leading messages delivered to all of their topics and the first error.
+// Messages after a failed one may still be delivered, so on retry they can be published twice.
+func (p *Producer) publishAcked(ctx context.Context, msgs []*Message) (int, error) {
+	var (
+		results []chan error
+		counts  []int
+		sendErr error
+	)
+
+	for _, msg := range msgs {
+		topics, err := p.topics(msg)
+		if err != nil {
+			sendErr = err
+			break
+		}
+
+		// Buffered for every topic, so the handlers never block on a publisher which stopped waiting.
+		acked := make(chan error, len(topics))
+		if sendErr = p.send(ctx, msg, acked); sendErr != nil {
+			break
+		}
+
+		results = append(results, acked)
+		counts = append(counts, len(topics))
+	}
+
+	for i, acked := range results {
+		for n := 0; n < counts[i]; n++ {
+			select {
+			case err := <-acked:
+				if err != nil {
+					return i, err
+				}
+			case <-ctx.Done():
+				return i, ctx.Err()
+			}
+		}
+	}
+
+	return len(results), sendErr
+}
+
+func (p *Producer) onSuccess(msg *Message, partition int32, offset int64) {
+	if p.callbacks.OnSuccess != nil {
+		p.callbacks.OnSuccess(msg, partition, offset)
+	}
+}
+
+func (p *Producer) onError(msg *Message, err error) {
+	if p.callbacks.OnError != nil {
+		p.callbacks.OnError(msg, err)
+	}
+}
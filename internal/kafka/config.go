@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Producer modes.
+const (
+	ProducerModeSync  = "sync"
+	ProducerModeAsync = "async"
+)
+
+// DefaultMaxBuffered is the default number of messages
+// the async producer holds before Publish blocks.
+const DefaultMaxBuffered = 1000
+
+// ProducerConfig configures the producer.
+type ProducerConfig struct {
+	// Routes maps the message names to the topics.
+	Routes Routes
+	// Partitioner chooses the partition of a message. Defaults to the hash partitioner.
+	Partitioner sarama.PartitionerConstructor
+	// Compression is the compression codec of the message batches.
+	Compression sarama.CompressionCodec
+	// Security configures TLS and SASL.
+	Security SecurityConfig
+	// TracerProvider creates the produce spans. Defaults to the global tracer provider.
+	TracerProvider oteltrace.TracerProvider
+
+	// Idempotent makes the broker drop the duplicates created by the producer retries.
+	Idempotent bool
+	// TransactionID enables transactions, so a batch of messages is committed atomically.
+	// It has to be unique for every running producer. Transactional producer is always idempotent
+	// and can't be used in async mode.
+	TransactionID string
+
+	// Async makes Publish return as soon as the message is buffered.
+	// Delivery results are reported to the callbacks and failed messages are
+	// written to the spool. In sync mode Publish waits for the broker acknowledgement.
+	Async bool
+	// Linger is the time the async producer waits to fill a batch.
+	Linger time.Duration
+	// BatchSize is the number of messages which triggers sending a batch in async mode.
+	BatchSize int
+	// BatchBytes is the size in bytes which triggers sending a batch in async mode.
+	BatchBytes int
+	// MaxBuffered is the number of messages waiting for the acknowledgement in async mode.
+	// Publish blocks until there is room in the buffer. Defaults to DefaultMaxBuffered.
+	MaxBuffered int
+
+	// Callbacks are called with the result of every sent message.
+	Callbacks Callbacks
+	// Spool stores the messages which failed in async mode, so they can be retried. Optional.
+	Spool Spool
+}
+
+// Callbacks are notified about the delivery of the messages. Both are optional.
+// Message passed to the callbacks contains the resolved topic and all sent headers.
+// In async mode callbacks are called from the producer goroutines, so they must not block.
+type Callbacks struct {
+	OnSuccess func(msg *Message, partition int32, offset int64)
+	OnError   func(msg *Message, err error)
+}
+
+// Spool stores the messages which could not be delivered, to be published again later.
+type Spool interface {
+	Append(msg *Message, cause error) error
+}
+
+// ParseCompression parses the compression codec name (none, gzip, snappy, lz4 or zstd).
+// Empty name returns no compression.
+func ParseCompression(name string) (sarama.CompressionCodec, error) {
+	var codec sarama.CompressionCodec
+	if name == "" {
+		return sarama.CompressionNone, nil
+	}
+
+	if err := codec.UnmarshalText([]byte(name)); err != nil {
+		return sarama.CompressionNone, err
+	}
+
+	return codec, nil
+}
+
+// saramaConfig builds the sarama configuration of the producer.
+func (c ProducerConfig) saramaConfig() (*sarama.Config, error) {
+	if c.Async && c.TransactionID != "" {
+		return nil, errors.New("transactional kafka producer can't be async")
+	}
+
+	cfg := sarama.NewConfig()
+	if err := c.Security.apply(cfg); err != nil {
+		return nil, err
+	}
+
+	if c.Idempotent || c.TransactionID != "" {
+		cfg.Producer.Idempotent = true
+		// Idempotence requires all in-sync replicas to acknowledge the message
+		// and a single request in flight, so the retries can't reorder the messages.
+		cfg.Producer.RequiredAcks = sarama.WaitForAll
+		cfg.Net.MaxOpenRequests = 1
+		cfg.Producer.Transaction.ID = c.TransactionID
+	}
+
+	cfg.Producer.Return.Errors = true
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Compression = c.Compression
+
+	if c.Partitioner != nil {
+		cfg.Producer.Partitioner = c.Partitioner
+	}
+
+	if c.Async {
+		cfg.Producer.Flush.Frequency = c.Linger
+		cfg.Producer.Flush.Messages = c.BatchSize
+		cfg.Producer.Flush.Bytes = c.BatchBytes
+		cfg.ChannelBufferSize = c.maxBuffered()
+	}
+
+	return cfg, nil
+}
+
+func (c ProducerConfig) maxBuffered() int {
+	if c.MaxBuffered <= 0 {
+		return DefaultMaxBuffered
+	}
+
+	return c.MaxBuffered
+}
+
+// tracer returns the tracer of the produce spans.
+func (c ProducerConfig) tracer() oteltrace.Tracer {
+	tp := c.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return tp.Tracer(tracerName)
+}
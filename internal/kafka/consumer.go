@@ -0,0 +1,303 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/cenkalti/backoff"
+	ccid "github.com/kperanovic/epam-systems/internal/cid"
+	logger "github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a failed message is retried
+	// before it is sent to the dead-letter topic.
+	DefaultMaxRetries = 3
+
+	// consumeRetryInterval is the time to wait before joining
+	// the consumer group again after a failed session.
+	consumeRetryInterval = time.Second
+
+	// Headers added to the messages sent to the dead-letter topic.
+	DLQTopicHeader     = "x-dlq-topic"
+	DLQPartitionHeader = "x-dlq-partition"
+	DLQOffsetHeader    = "x-dlq-offset"
+	DLQErrorHeader     = "x-dlq-error"
+)
+
+// HandlerFunc handles a single consumed message.
+// The context contains the correlation id and the logger of the message.
+// Returned errors are retried, unless they are wrapped with Permanent().
+type HandlerFunc func(ctx context.Context, msg *sarama.ConsumerMessage) error
+
+// permanentError marks an error which will not go away by retrying.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps the error so the message is not retried
+// and is sent to the dead-letter topic straight away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether the error was wrapped with Permanent().
+func IsPermanent(err error) bool {
+	var p *permanentError
+
+	return errors.As(err, &p)
+}
+
+// Consumer consumes the topics as a member of a consumer group and dispatches
+// the messages by the MessageNameHeader to the registered handlers.
+//
+// Offset of a message is committed only after its handler succeeded,
+// so messages are processed at least once. Messages whose handler keeps failing
+// are sent to the dead-letter topic and skipped. Messages without a registered
+// handler are skipped.
+type Consumer struct {
+	log        *zap.Logger
+	group      sarama.ConsumerGroup
+	topics     []string
+	handlers   map[string]HandlerFunc
+	dlq        *Producer
+	dlqTopic   string
+	maxRetries uint64
+	backoff    func() backoff.BackOff
+}
+
+// NewKafkaConsumer creates a new consumer group member for the given topics.
+// Poison messages are published to the dlqTopic using the dlq producer.
+// Connections to the brokers are secured with the security configuration.
+func NewKafkaConsumer(brokers []string, groupID string, topics []string, security SecurityConfig, dlq *Producer, dlqTopic string, log *zap.Logger) (*Consumer, error) {
+	cfg := sarama.NewConfig()
+	if err := security.apply(cfg); err != nil {
+		return nil, err
+	}
+
+	cfg.Consumer.Return.Errors = true
+	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	// Offsets are committed manually after the message was applied.
+	cfg.Consumer.Offsets.AutoCommit.Enable = false
+
+	group, err := sarama.NewConsumerGroup(brokers, groupID, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConsumer(group, topics, dlq, dlqTopic, log), nil
+}
+
+func newConsumer(group sarama.ConsumerGroup, topics []string, dlq *Producer, dlqTopic string, log *zap.Logger) *Consumer {
+	return &Consumer{
+		log:        log,
+		group:      group,
+		topics:     topics,
+		handlers:   make(map[string]HandlerFunc),
+		dlq:        dlq,
+		dlqTopic:   dlqTopic,
+		maxRetries: DefaultMaxRetries,
+		backoff: func() backoff.BackOff {
+			return backoff.NewExponentialBackOff()
+		},
+	}
+}
+
+// Handle registers the handler for messages with the given name.
+// Handlers have to be registered before calling Run().
+func (c *Consumer) Handle(msgName string, handler HandlerFunc) {
+	c.handlers[msgName] = handler
+}
+
+// Run consumes the messages until the context is done.
+// Consumer group session is restarted after every rebalance.
+func (c *Consumer) Run(ctx context.Context) {
+	c.log.Info("starting kafka consumer", zap.Strings("topics", c.topics))
+
+	go func() {
+		for err := range c.group.Errors() {
+			c.log.Error("consumer group error", zap.Error(err))
+		}
+	}()
+
+	for {
+		delay := time.Duration(0)
+
+		if err := c.group.Consume(ctx, c.topics, c); err != nil {
+			c.log.Error("error consuming messages", zap.Error(err))
+
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+
+			delay = consumeRetryInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			c.log.Info("stopping kafka consumer")
+
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Close will close the consumer group and log an error if it happened.
+func (c *Consumer) Close() {
+	if err := c.group.Close(); err != nil {
+		c.log.Error("error closing consumer group", zap.Error(err))
+	}
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim.
+func (c *Consumer) Setup(session sarama.ConsumerGroupSession) error {
+	c.log.Info("consumer group session started", zap.Any("claims", session.Claims()))
+
+	return nil
+}
+
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited.
+func (c *Consumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	c.log.Info("consumer group session ended")
+
+	return nil
+}
+
+// ConsumeClaim processes the messages of a single partition in order.
+// Returning an error ends the session, so the messages after the last
+// committed offset are consumed again once the session is restarted.
+func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			if err := c.process(session.Context(), msg); err != nil {
+				return err
+			}
+
+			session.MarkMessage(msg, "")
+			session.Commit()
+		}
+	}
+}
+
+// process dispatches the message to its handler and retries failures.
+// Message is sent to the dead-letter topic if the handler didn't succeed.
+// Returned error means the message has to be consumed again.
+func (c *Consumer) process(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	headers := recordHeaders(msg.Headers)
+
+	cid := headers[CIDHeader]
+	if cid == "" {
+		cid = ccid.New()
+	}
+
+	ctx = ccid.WithContext(ctx, cid)
+
+	// Trace is continued by the changes and the events caused by the message.
+	if tc, ok := trace.FromHeaders(headers); ok {
+		ctx = trace.WithContext(ctx, tc)
+	}
+
+	log := c.log.With(
+		zap.String("cid", cid),
+		zap.String("topic", msg.Topic),
+		zap.Int32("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+		zap.String("msgName", headers[MessageNameHeader]),
+	)
+	ctx = logger.WithContext(ctx, log)
+
+	handler, ok := c.handlers[headers[MessageNameHeader]]
+	if !ok {
+		log.Debug("skipping message without a handler")
+
+		return nil
+	}
+
+	err := backoff.RetryNotify(
+		func() error {
+			if err := handler(ctx, msg); err != nil {
+				if IsPermanent(err) {
+					return backoff.Permanent(err)
+				}
+
+				return err
+			}
+
+			return nil
+		},
+		backoff.WithContext(backoff.WithMaxRetries(c.backoff(), c.maxRetries), ctx),
+		func(err error, next time.Duration) {
+			log.Warn("error handling message", zap.Error(err), zap.Duration("retryIn", next))
+		},
+	)
+	if err == nil {
+		log.Info("message handled")
+
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		// Session is over, message will be consumed again.
+		return ctx.Err()
+	}
+
+	log.Error("sending message to the dead-letter topic", zap.Error(err))
+
+	return c.deadLetter(ctx, msg, headers, err)
+}
+
+// deadLetter publishes the message to the dead-letter topic together
+// with the original topic, partition, offset and the error.
+func (c *Consumer) deadLetter(ctx context.Context, msg *sarama.ConsumerMessage, headers map[string]string, cause error) error {
+	headers[DLQTopicHeader] = msg.Topic
+	headers[DLQPartitionHeader] = strconv.FormatInt(int64(msg.Partition), 10)
+	headers[DLQOffsetHeader] = strconv.FormatInt(msg.Offset, 10)
+	headers[DLQErrorHeader] = cause.Error()
+
+	return c.dlq.Publish(ctx, &Message{
+		Topic:        c.dlqTopic,
+		PartitionKey: string(msg.Key),
+		Name:         headers[MessageNameHeader],
+		Payload:      msg.Value,
+		Headers:      headers,
+	})
+}
+
+// recordHeaders converts the consumed record headers to a map.
+func recordHeaders(rh []*sarama.RecordHeader) map[string]string {
+	headers := make(map[string]string, len(rh))
+	for _, h := range rh {
+		if h == nil {
+			continue
+		}
+
+		headers[string(h.Key)] = string(h.Value)
+	}
+
+	return headers
+}
@@ -0,0 +1,187 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/cenkalti/backoff"
+	"github.com/go-playground/assert/v2"
+	ccid "github.com/kperanovic/epam-systems/internal/cid"
+	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/trace"
+)
+
+// testSession is a sarama.ConsumerGroupSession which records the marked offsets.
+type testSession struct {
+	ctx     context.Context
+	marked  []int64
+	commits int
+}
+
+func (s *testSession) Claims() map[string][]int32 { return nil }
+func (s *testSession) MemberID() string           { return "test" }
+func (s *testSession) GenerationID() int32        { return 1 }
+func (s *testSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *testSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *testSession) Commit()                  { s.commits++ }
+func (s *testSession) Context() context.Context { return s.ctx }
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+// testClaim is a sarama.ConsumerGroupClaim serving the given messages.
+type testClaim struct {
+	msgs chan *sarama.ConsumerMessage
+}
+
+func newTestClaim(msgs ...*sarama.ConsumerMessage) *testClaim {
+	ch := make(chan *sarama.ConsumerMessage, len(msgs))
+	for _, msg := range msgs {
+		ch <- msg
+	}
+	close(ch)
+
+	return &testClaim{msgs: ch}
+}
+
+func (c *testClaim) Topic() string                            { return "company.commands" }
+func (c *testClaim) Partition() int32                         { return 0 }
+func (c *testClaim) InitialOffset() int64                     { return 0 }
+func (c *testClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage { return c.msgs }
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func testMessage(offset int64, name string) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Topic:  "company.commands",
+		Offset: offset,
+		Key:    []byte("key"),
+		Value:  []byte("{}"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(MessageNameHeader), Value: []byte(name)},
+			{Key: []byte(CIDHeader), Value: []byte("test-cid")},
+			{Key: []byte(trace.TraceParentHeader), Value: []byte(testTraceParent)},
+		},
+	}
+}
+
+// newTestConsumer creates a consumer which retries without waiting.
+func newTestConsumer(dlq *mocks.SyncProducer) *Consumer {
+	log := logger.NewDevelopment()
+
+	c := newConsumer(nil, []string{"company.commands"}, NewMockProducer(dlq, Routes{}, log), "company.commands.dlq", log)
+	c.backoff = func() backoff.BackOff {
+		return &backoff.ZeroBackOff{}
+	}
+
+	return c
+}
+
+func TestConsumer_ConsumeClaim(t *testing.T) {
+	dlq := mocks.NewSyncProducer(t, nil)
+	c := newTestConsumer(dlq)
+
+	var cids, traces []string
+	c.Handle("CREATE", func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		cids = append(cids, ccid.FromContext(ctx))
+
+		tc, _ := trace.FromContext(ctx)
+		traces = append(traces, tc.TraceParent())
+
+		return nil
+	})
+
+	session := &testSession{ctx: context.Background()}
+
+	// Message without a handler is skipped, but its offset is committed as well
+	err := c.ConsumeClaim(session, newTestClaim(testMessage(1, "CREATE"), testMessage(2, "UNKNOWN")))
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, cids, []string{"test-cid"})
+	assert.Equal(t, traces, []string{testTraceParent})
+	assert.Equal(t, session.marked, []int64{1, 2})
+	assert.Equal(t, session.commits, 2)
+}
+
+func TestConsumer_ConsumeClaim_DeadLetter(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{
+			name:     "Test permanent error is not retried",
+			err:      Permanent(errors.New("invalid command")),
+			attempts: 1,
+		},
+		{
+			name:     "Test error is retried before sending to dead-letter topic",
+			err:      errors.New("database unavailable"),
+			attempts: DefaultMaxRetries + 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dlq := mocks.NewSyncProducer(t, nil)
+			dlq.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+				headers := map[string]string{}
+				for _, h := range msg.Headers {
+					headers[string(h.Key)] = string(h.Value)
+				}
+
+				if msg.Topic != "company.commands.dlq" {
+					return errors.New("message is not sent to the dead-letter topic")
+				}
+
+				if headers[DLQErrorHeader] != tt.err.Error() || headers[DLQOffsetHeader] != "1" || headers[CIDHeader] != "test-cid" {
+					return errors.New("dead-letter headers are not set")
+				}
+
+				return nil
+			})
+
+			c := newTestConsumer(dlq)
+
+			attempts := 0
+			c.Handle("CREATE", func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+				attempts++
+
+				return tt.err
+			})
+
+			session := &testSession{ctx: context.Background()}
+
+			// Poison message is committed, so it doesn't block the partition
+			err := c.ConsumeClaim(session, newTestClaim(testMessage(1, "CREATE")))
+			assert.Equal(t, err, nil)
+			assert.Equal(t, attempts, tt.attempts)
+			assert.Equal(t, session.marked, []int64{1})
+
+			assert.Equal(t, dlq.Close(), nil)
+		})
+	}
+}
+
+func TestConsumer_ConsumeClaim_DeadLetterFailure(t *testing.T) {
+	dlq := mocks.NewSyncProducer(t, nil)
+	dlq.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+
+	c := newTestConsumer(dlq)
+	c.Handle("CREATE", func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return Permanent(errors.New("invalid command"))
+	})
+
+	session := &testSession{ctx: context.Background()}
+
+	// Offset is not committed, so the message is consumed again in the next session
+	err := c.ConsumeClaim(session, newTestClaim(testMessage(1, "CREATE")))
+	assert.Equal(t, err, sarama.ErrOutOfBrokers)
+	assert.Equal(t, len(session.marked), 0)
+	assert.Equal(t, session.commits, 0)
+}
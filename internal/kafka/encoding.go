@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ContentTypeHeader defines the header name holding
+// the content type of the message payload.
+const ContentTypeHeader = "content-type"
+
+// Content types of the encoded messages.
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeJSON     = "application/json"
+)
+
+// Encoding defines how protobuf messages are encoded.
+type Encoding string
+
+const (
+	// EncodingProtobuf encodes messages in the protobuf binary format.
+	EncodingProtobuf Encoding = "protobuf"
+	// EncodingJSON encodes messages in the protobuf JSON format.
+	EncodingJSON Encoding = "json"
+)
+
+// ParseEncoding parses the encoding name.
+func ParseEncoding(name string) (Encoding, error) {
+	switch enc := Encoding(name); enc {
+	case EncodingProtobuf, EncodingJSON:
+		return enc, nil
+	default:
+		return "", fmt.Errorf("unknown encoding %q", name)
+	}
+}
+
+// ContentType returns the content type sent in the ContentTypeHeader.
+func (e Encoding) ContentType() string {
+	if e == EncodingJSON {
+		return ContentTypeJSON
+	}
+
+	return ContentTypeProtobuf
+}
+
+// Encode encodes the message. Unknown encodings fall back to protobuf.
+func (e Encoding) Encode(msg proto.Message) ([]byte, error) {
+	if e == EncodingJSON {
+		return protojson.Marshal(msg)
+	}
+
+	return proto.Marshal(msg)
+}
+
+// Decode decodes the payload into msg according to its content type.
+// Missing content type is decoded as protobuf.
+func Decode(contentType string, payload []byte, msg proto.Message) error {
+	switch contentType {
+	case ContentTypeJSON:
+		return protojson.Unmarshal(payload, msg)
+	case ContentTypeProtobuf, "":
+		return proto.Unmarshal(payload, msg)
+	default:
+		return fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
@@ -17,6 +17,10 @@ const (
 	// MessageNameHeader defines the message name
 	// header name used in kafka messages.
 	MessageNameHeader = "x-message-name"
+
+	// EventIDHeader defines the event id header name used in kafka messages.
+	// The id is the same for every delivery of an event, so consumers can deduplicate them.
+	EventIDHeader = "x-event-id"
 )
 
 // HeadersToJSON is a helper function that
@@ -0,0 +1,44 @@
+package kafka
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/Shopify/sarama"
+)
+
+// Partitioner names accepted by ParsePartitioner.
+const (
+	// PartitionerHash sends messages with the same key to the same partition (FNV-1a hash).
+	// It is the default partitioner.
+	PartitionerHash = "hash"
+	// PartitionerReference is the hash partitioner compatible with the reference Java client.
+	PartitionerReference = "reference"
+	// PartitionerCRC32 is the hash partitioner compatible with librdkafka clients.
+	PartitionerCRC32 = "crc32"
+	// PartitionerRoundRobin spreads the messages evenly, ignoring the key.
+	// Per key ordering is not guaranteed.
+	PartitionerRoundRobin = "roundrobin"
+	// PartitionerRandom sends the messages to random partitions, ignoring the key.
+	// Per key ordering is not guaranteed.
+	PartitionerRandom = "random"
+)
+
+// ParsePartitioner returns the partitioner strategy with the given name.
+// Empty name returns the default hash partitioner.
+func ParsePartitioner(name string) (sarama.PartitionerConstructor, error) {
+	switch name {
+	case PartitionerHash, "":
+		return sarama.NewHashPartitioner, nil
+	case PartitionerReference:
+		return sarama.NewReferenceHashPartitioner, nil
+	case PartitionerCRC32:
+		return sarama.NewCustomHashPartitioner(crc32.NewIEEE), nil
+	case PartitionerRoundRobin:
+		return sarama.NewRoundRobinPartitioner, nil
+	case PartitionerRandom:
+		return sarama.NewRandomPartitioner, nil
+	default:
+		return nil, fmt.Errorf("unknown partitioner %q", name)
+	}
+}
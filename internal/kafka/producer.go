@@ -2,81 +2,305 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"sync"
 
 	"github.com/Shopify/sarama"
 	"github.com/Shopify/sarama/mocks"
 	ccid "github.com/kperanovic/epam-systems/internal/cid"
 	logger "github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 )
 
 type Producer struct {
-	log      *zap.Logger
-	producer sarama.SyncProducer
+	log       *zap.Logger
+	producer  sarama.SyncProducer
+	async     sarama.AsyncProducer
+	routes    Routes
+	callbacks Callbacks
+	spool     Spool
+	tracer    oteltrace.Tracer
+
+	// txnMu serializes the transactions of a transactional producer.
+	txnMu sync.Mutex
+
+	// inflight bounds the messages waiting for the acknowledgement in async mode.
+	inflight chan struct{}
+	wg       sync.WaitGroup
+	stats    producerStats
 }
 
-func NewKafkaProducer(brokers []string, topic string, log *zap.Logger) (*Producer, error) {
-	cfg := sarama.NewConfig()
-	cfg.Producer.Return.Errors = true
-	cfg.Producer.Return.Successes = true
+// NewKafkaProducer creates a new producer publishing the messages
+// to the topics resolved from the routes. Partition of a message is chosen
+// by the partitioner from the message partition key.
+// Async mode is enabled with ProducerConfig.Async.
+func NewKafkaProducer(brokers []string, cfg ProducerConfig, log *zap.Logger) (*Producer, error) {
+	saramaCfg, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
 
-	producer, err := sarama.NewSyncProducer(brokers, cfg)
+	if cfg.Async {
+		producer, err := sarama.NewAsyncProducer(brokers, saramaCfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return newAsyncProducer(producer, cfg, log), nil
+	}
+
+	producer, err := sarama.NewSyncProducer(brokers, saramaCfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Producer{
-		log:      log,
-		producer: producer,
-	}, nil
+	return newSyncProducer(producer, cfg, log), nil
 }
 
 // NewMockProducer will create a new kafka producer
 // with `mocks.SyncProducer` as the underlying sarama producer.
-func NewMockProducer(producer *mocks.SyncProducer, log *zap.Logger) *Producer {
+func NewMockProducer(producer *mocks.SyncProducer, routes Routes, log *zap.Logger) *Producer {
+	return newSyncProducer(producer, ProducerConfig{Routes: routes}, log)
+}
+
+// NewMockAsyncProducer will create a new async kafka producer
+// with `mocks.AsyncProducer` as the underlying sarama producer.
+// The mock must be created with Producer.Return.Successes enabled.
+func NewMockAsyncProducer(producer *mocks.AsyncProducer, cfg ProducerConfig, log *zap.Logger) *Producer {
+	return newAsyncProducer(producer, cfg, log)
+}
+
+func newSyncProducer(producer sarama.SyncProducer, cfg ProducerConfig, log *zap.Logger) *Producer {
 	return &Producer{
-		producer: producer,
-		log:      log,
+		log:       log,
+		producer:  producer,
+		routes:    cfg.Routes,
+		callbacks: cfg.Callbacks,
+		spool:     cfg.Spool,
+		tracer:    cfg.tracer(),
 	}
 }
 
+func newAsyncProducer(producer sarama.AsyncProducer, cfg ProducerConfig, log *zap.Logger) *Producer {
+	p := &Producer{
+		log:       log,
+		async:     producer,
+		routes:    cfg.Routes,
+		callbacks: cfg.Callbacks,
+		spool:     cfg.Spool,
+		tracer:    cfg.tracer(),
+		inflight:  make(chan struct{}, cfg.maxBuffered()),
+	}
+
+	p.wg.Add(2)
+	go p.handleSuccesses()
+	go p.handleErrors()
+
+	return p
+}
+
 // Close will close the producer and log an error if it happened.
+// In async mode buffered messages are flushed and their callbacks called before Close returns.
 func (p *Producer) Close() {
+	if p.async != nil {
+		p.async.AsyncClose()
+		p.wg.Wait()
+
+		return
+	}
+
 	if err := p.producer.Close(); err != nil {
 		p.log.Error("error closing producer", zap.Error(err))
 	}
 }
 
-// SendMessage sends proto message to a given topic
-func (p *Producer) SendMessage(ctx context.Context, topic string, partitionKey string, msgName string, msg interface{}) error {
-	ctx, cid := ccid.FromContextOrNew(ctx)
-	log := p.getLogger(ctx, cid)
-
-	headers := p.createHeaders(msgName, cid)
+// Message is an already encoded message ready to be published.
+type Message struct {
+	// Topic overrides the routes of the producer. If it is empty,
+	// message is published to the topics routed by its name.
+	Topic string
+	// PartitionKey selects the partition, so messages with the same key are kept in order.
+	// Company events are keyed by the company id. Messages without a key are spread by the partitioner.
+	PartitionKey string
+	// Name is sent in the MessageNameHeader.
+	Name    string
+	Payload []byte
+	// Headers are sent in addition to the message name and correlation id headers.
+	Headers map[string]string
+}
 
-	toSend, err := json.Marshal(msg)
+// SendMessage sends proto message to the topics routed by the message name.
+// Message is encoded with the given encoding and its content type is sent in the ContentTypeHeader.
+func (p *Producer) SendMessage(ctx context.Context, partitionKey string, msgName string, encoding Encoding, msg proto.Message) error {
+	toSend, err := encoding.Encode(msg)
 	if err != nil {
 		return err
 	}
 
-	m := &sarama.ProducerMessage{
-		Topic:   topic,
-		Key:     sarama.StringEncoder(partitionKey),
-		Value:   sarama.ByteEncoder(toSend),
-		Headers: p.createRecordHeaders(headers),
+	return p.Publish(ctx, &Message{
+		PartitionKey: partitionKey,
+		Name:         msgName,
+		Payload:      toSend,
+		Headers: map[string]string{
+			ContentTypeHeader: encoding.ContentType(),
+		},
+	})
+}
+
+// Publish sends the already encoded message.
+// In async mode Publish returns once the message is buffered and the delivery is reported
+// to the callbacks and the spool, blocking while the buffer is full.
+// Message routed to several topics is sent to them one by one and the first failure is returned,
+// so on retry it can be published again to the topics which already received it.
+// Transactional producer sends the message to all topics in one transaction.
+func (p *Producer) Publish(ctx context.Context, msg *Message) error {
+	if p.async != nil {
+		return p.send(ctx, msg, nil)
+	}
+
+	_, err := p.PublishBatch(ctx, []*Message{msg})
+
+	return err
+}
+
+// PublishBatch sends the messages in order and returns the number of sent messages.
+// In async mode the messages are batched in the background, but PublishBatch waits until
+// the broker acknowledges them, so only the delivered messages are counted.
+// Transactional producer sends all messages in one transaction, so either all of them
+// are committed or none is and zero is returned. Otherwise sending stops at the first failure.
+func (p *Producer) PublishBatch(ctx context.Context, msgs []*Message) (int, error) {
+	if p.async != nil {
+		return p.publishAcked(ctx, msgs)
+	}
+
+	if !p.producer.IsTransactional() {
+		for i, msg := range msgs {
+			if err := p.send(ctx, msg, nil); err != nil {
+				return i, err
+			}
+		}
+
+		return len(msgs), nil
+	}
+
+	p.txnMu.Lock()
+	defer p.txnMu.Unlock()
+
+	if err := p.producer.BeginTxn(); err != nil {
+		return 0, err
+	}
+
+	for _, msg := range msgs {
+		if err := p.send(ctx, msg, nil); err != nil {
+			p.abortTxn()
+
+			return 0, err
+		}
+	}
+
+	if err := p.producer.CommitTxn(); err != nil {
+		p.abortTxn()
+
+		return 0, err
+	}
+
+	return len(msgs), nil
+}
+
+// abortTxn aborts the current transaction and logs an error if it happened.
+func (p *Producer) abortTxn() {
+	if err := p.producer.AbortTxn(); err != nil {
+		p.log.Error("error aborting kafka transaction", zap.Error(err))
 	}
+}
 
-	partition, offset, err := p.producer.SendMessage(m)
+// send sends the message to its topics.
+// Every topic is sent in its own producer span, which continues the trace context
+// of the message headers, or of the context if the message has none.
+// Trace context headers of the sent message identify the producer span.
+// In async mode the delivery result of every topic is sent to acked, if it isn't nil.
+func (p *Producer) send(ctx context.Context, msg *Message, acked chan<- error) error {
+	ctx, cid := ccid.FromContextOrNew(ctx)
+	log := p.getLogger(ctx, cid)
+
+	topics, err := p.topics(msg)
 	if err != nil {
 		return err
 	}
 
-	log.Info("message sent", zap.Int32("partition", partition), zap.Int64("offset", offset))
+	// Messages published by the outbox relay carry the trace context of the request which caused them.
+	if tc, ok := trace.FromHeaders(msg.Headers); ok {
+		ctx = trace.WithContext(ctx, tc)
+	}
+
+	for _, topic := range topics {
+		spanCtx, span := p.startSpan(ctx, topic, msg)
+
+		headers := p.createHeaders(msg.Name, cid)
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		trace.Inject(spanCtx, headers)
+
+		sent := &Message{
+			Topic:        topic,
+			PartitionKey: msg.PartitionKey,
+			Name:         msg.Name,
+			Payload:      msg.Payload,
+			Headers:      headers,
+		}
+
+		m := &sarama.ProducerMessage{
+			Topic:    topic,
+			Value:    sarama.ByteEncoder(msg.Payload),
+			Headers:  p.createRecordHeaders(headers),
+			Metadata: &produced{msg: sent, span: span, acked: acked},
+		}
+
+		// Empty key would send all messages without a key to the same partition.
+		if msg.PartitionKey != "" {
+			m.Key = sarama.StringEncoder(msg.PartitionKey)
+		}
+
+		if p.async != nil {
+			if err := p.enqueue(ctx, m); err != nil {
+				endSpan(span, 0, 0, err)
+
+				return err
+			}
+
+			continue
+		}
+
+		partition, offset, err := p.producer.SendMessage(m)
+		endSpan(span, partition, offset, err)
+
+		if err != nil {
+			p.stats.failed.Add(1)
+			p.onError(sent, err)
+
+			return err
+		}
+
+		log.Info("message sent", zap.String("topic", topic), zap.Int32("partition", partition), zap.Int64("offset", offset))
+		p.stats.sent.Add(1)
+		p.onSuccess(sent, partition, offset)
+	}
 
 	return nil
 }
 
+// topics returns the topic of the message, or the topics routed by its name.
+func (p *Producer) topics(msg *Message) ([]string, error) {
+	if msg.Topic != "" {
+		return []string{msg.Topic}, nil
+	}
+
+	return p.routes.Resolve(msg.Name)
+}
+
 // createHeaders will create the kafka headers.
 func (p *Producer) createHeaders(msgName, cid string) map[string]string {
 	return map[string]string{
@@ -85,16 +309,15 @@ func (p *Producer) createHeaders(msgName, cid string) map[string]string {
 	}
 }
 
-// getLogger will try to load the logger from the context.
-// If the logger doesn't exists it will load the instance logger.
-// The function will then add the correlation id filed to it
-// and return it
+// getLogger will try to load the logger from the context,
+// which already carries the correlation id.
+// If the logger doesn't exists it will add the correlation id
+// field to the instance logger and return it.
 func (p *Producer) getLogger(ctx context.Context, cid string) *zap.Logger {
-	log := logger.FromContext(ctx)
-	if log == nil {
-		log = p.log
+	if log := logger.FromContext(ctx); log != nil {
+		return log
 	}
-	return log.With(zap.String("cid", cid))
+	return p.log.With(zap.String("cid", cid))
 }
 
 // createRecordHeaders converts the headers map
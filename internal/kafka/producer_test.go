@@ -0,0 +1,347 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/go-playground/assert/v2"
+	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/trace"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// expectTopic returns a message checker which verifies the topic of the sent message.
+func expectTopic(topic string) mocks.MessageChecker {
+	return func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != topic {
+			return fmt.Errorf("unexpected topic %q, want %q", msg.Topic, topic)
+		}
+
+		return nil
+	}
+}
+
+func TestProducer_Publish_Routes(t *testing.T) {
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectTopic("dev.company.created"))
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectTopic("dev.company.audit"))
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectTopic("dev.company.commands"))
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectTopic("company.commands.dlq"))
+
+	p := NewMockProducer(mockProducer, Routes{
+		Default: "company.commands",
+		Prefix:  "dev.",
+		Topics: map[string][]string{
+			"COMPANY_CREATED": {"company.created", "company.audit"},
+		},
+	}, logger.NewDevelopment())
+
+	// Routed message is fanned out to every topic
+	err := p.Publish(context.Background(), &Message{Name: "COMPANY_CREATED"})
+	assert.Equal(t, err, nil)
+
+	// Message without a route is sent to the default topic
+	err = p.Publish(context.Background(), &Message{Name: "COMPANY_DELETED"})
+	assert.Equal(t, err, nil)
+
+	// Explicit topic overrides the routes
+	err = p.Publish(context.Background(), &Message{Topic: "company.commands.dlq", Name: "COMPANY_CREATED"})
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, mockProducer.Close(), nil)
+}
+
+func TestProducer_Publish_PartitionKey(t *testing.T) {
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		key, _ := msg.Key.Encode()
+		if string(key) != "company-id" {
+			return fmt.Errorf("message key = %q, want %q", key, "company-id")
+		}
+
+		return nil
+	})
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		// Messages without a key are spread by the partitioner instead of sharing the partition of the empty key
+		if msg.Key != nil {
+			return fmt.Errorf("message key = %v, want nil", msg.Key)
+		}
+
+		return nil
+	})
+
+	p := NewMockProducer(mockProducer, Routes{Default: "company.commands"}, logger.NewDevelopment())
+
+	err := p.Publish(context.Background(), &Message{Name: "COMPANY_CREATED", PartitionKey: "company-id"})
+	assert.Equal(t, err, nil)
+
+	err = p.Publish(context.Background(), &Message{Name: "COMPANY_CREATED"})
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, mockProducer.Close(), nil)
+}
+
+func TestParsePartitioner(t *testing.T) {
+	for _, name := range []string{"", PartitionerHash, PartitionerReference, PartitionerCRC32, PartitionerRoundRobin, PartitionerRandom} {
+		if _, err := ParsePartitioner(name); err != nil {
+			t.Errorf("ParsePartitioner(%q) error = %v", name, err)
+		}
+	}
+
+	if _, err := ParsePartitioner("unknown"); err == nil {
+		t.Errorf("ParsePartitioner(%q) expected error", "unknown")
+	}
+}
+
+// testSpool is a Spool which records the appended messages.
+type testSpool struct {
+	msgs []*Message
+}
+
+func (s *testSpool) Append(msg *Message, cause error) error {
+	s.msgs = append(s.msgs, msg)
+
+	return nil
+}
+
+func TestProducer_Publish_Async(t *testing.T) {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+
+	mockProducer := mocks.NewAsyncProducer(t, cfg)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(expectTopic("company.created"))
+	mockProducer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	var (
+		succeeded []string
+		failed    []error
+	)
+
+	spool := &testSpool{}
+
+	p := NewMockAsyncProducer(mockProducer, ProducerConfig{
+		Routes: Routes{Default: "company.created"},
+		Callbacks: Callbacks{
+			OnSuccess: func(msg *Message, partition int32, offset int64) {
+				succeeded = append(succeeded, msg.Name)
+			},
+			OnError: func(msg *Message, err error) {
+				failed = append(failed, err)
+			},
+		},
+		Spool: spool,
+	}, logger.NewDevelopment())
+
+	// Delivery errors are not returned from Publish, but reported to the callbacks
+	err := p.Publish(context.Background(), &Message{Name: "COMPANY_CREATED", PartitionKey: "company-id"})
+	assert.Equal(t, err, nil)
+
+	err = p.Publish(context.Background(), &Message{Name: "COMPANY_DELETED", PartitionKey: "company-id"})
+	assert.Equal(t, err, nil)
+
+	// Close waits for all callbacks
+	p.Close()
+
+	assert.Equal(t, succeeded, []string{"COMPANY_CREATED"})
+	assert.Equal(t, failed, []error{sarama.ErrOutOfBrokers})
+
+	// Failed message is spooled with the resolved topic and the sent headers
+	assert.Equal(t, len(spool.msgs), 1)
+	assert.Equal(t, spool.msgs[0].Topic, "company.created")
+	assert.Equal(t, spool.msgs[0].Headers[MessageNameHeader], "COMPANY_DELETED")
+
+	assert.Equal(t, p.Stats(), ProducerStats{Sent: 1, Failed: 1, Spooled: 1})
+}
+
+func TestProducer_PublishBatch_Async(t *testing.T) {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+
+	mockProducer := mocks.NewAsyncProducer(t, cfg)
+	mockProducer.ExpectInputAndSucceed()
+	mockProducer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+	mockProducer.ExpectInputAndSucceed()
+
+	spool := &testSpool{}
+
+	p := NewMockAsyncProducer(mockProducer, ProducerConfig{
+		Routes: Routes{Default: "company.created"},
+		Spool:  spool,
+	}, logger.NewDevelopment())
+
+	// PublishBatch waits for the acknowledgements and counts only the leading delivered messages
+	n, err := p.PublishBatch(context.Background(), []*Message{
+		{Name: "COMPANY_CREATED", PartitionKey: "company-id"},
+		{Name: "COMPANY_UPDATED", PartitionKey: "company-id"},
+		{Name: "COMPANY_DELETED", PartitionKey: "company-id"},
+	})
+	assert.Equal(t, n, 1)
+	assert.Equal(t, err, sarama.ErrOutOfBrokers)
+
+	p.Close()
+
+	// Failed message is returned to the caller instead of being spooled
+	assert.Equal(t, len(spool.msgs), 0)
+	assert.Equal(t, p.Stats(), ProducerStats{Sent: 2, Failed: 1})
+}
+
+func TestProducer_Publish_AsyncBufferFull(t *testing.T) {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+
+	mockProducer := mocks.NewAsyncProducer(t, cfg)
+
+	p := NewMockAsyncProducer(mockProducer, ProducerConfig{
+		Routes:      Routes{Default: "company.created"},
+		MaxBuffered: 1,
+	}, logger.NewDevelopment())
+
+	// Fill the buffer without acknowledging the message
+	p.inflight <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Publish blocks while the buffer is full, until the context is done
+	err := p.Publish(ctx, &Message{Name: "COMPANY_CREATED"})
+	assert.Equal(t, err, context.Canceled)
+	assert.Equal(t, p.Stats().Buffered, int64(1))
+
+	<-p.inflight
+	p.Close()
+}
+
+func TestParseCompression(t *testing.T) {
+	for _, name := range []string{"", "none", "gzip", "snappy", "lz4", "zstd"} {
+		_, err := ParseCompression(name)
+		assert.Equal(t, err, nil)
+	}
+
+	_, err := ParseCompression("brotli")
+	assert.NotEqual(t, err, nil)
+}
+
+// txnProducer records the ends of the transactions of the mock producer.
+type txnProducer struct {
+	*mocks.SyncProducer
+	committed int
+	aborted   int
+}
+
+func (p *txnProducer) CommitTxn() error {
+	p.committed++
+
+	return p.SyncProducer.CommitTxn()
+}
+
+func (p *txnProducer) AbortTxn() error {
+	p.aborted++
+
+	return p.SyncProducer.AbortTxn()
+}
+
+func TestProducer_PublishBatch_Transactional(t *testing.T) {
+	cfg := ProducerConfig{
+		Routes:        Routes{Default: "company.commands"},
+		TransactionID: "epam-systems-1",
+	}
+
+	saramaCfg, err := cfg.saramaConfig()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, saramaCfg.Producer.Idempotent, true)
+
+	// Mock producer fails if a message is sent outside of a transaction
+	mockProducer := &txnProducer{SyncProducer: mocks.NewSyncProducer(t, saramaCfg)}
+	mockProducer.ExpectSendMessageAndSucceed()
+	mockProducer.ExpectSendMessageAndSucceed()
+	mockProducer.ExpectSendMessageAndSucceed()
+	mockProducer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+
+	p := newSyncProducer(mockProducer, cfg, logger.NewDevelopment())
+
+	batch := []*Message{{Name: "COMPANY_CREATED"}, {Name: "COMPANY_UPDATED"}}
+
+	n, err := p.PublishBatch(context.Background(), batch)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 2)
+	assert.Equal(t, mockProducer.committed, 1)
+
+	// Failed message aborts the whole batch
+	n, err = p.PublishBatch(context.Background(), batch)
+	assert.Equal(t, err, sarama.ErrOutOfBrokers)
+	assert.Equal(t, n, 0)
+	assert.Equal(t, mockProducer.committed, 1)
+	assert.Equal(t, mockProducer.aborted, 1)
+
+	assert.Equal(t, mockProducer.Close(), nil)
+}
+
+func TestProducerConfig_saramaConfig(t *testing.T) {
+	cfg, err := ProducerConfig{Idempotent: true}.saramaConfig()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cfg.Validate(), nil)
+	assert.Equal(t, cfg.Producer.Transaction.ID, "")
+
+	// Transactions are only supported by the sync producer
+	_, err = ProducerConfig{Async: true, TransactionID: "epam-systems-1"}.saramaConfig()
+	assert.NotEqual(t, err, nil)
+}
+
+func TestProducer_Publish_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageAndSucceed()
+	mockProducer.ExpectSendMessageAndFail(sarama.ErrNotLeaderForPartition)
+
+	var sent []*Message
+	p := newSyncProducer(mockProducer, ProducerConfig{
+		Routes:         Routes{Topics: map[string][]string{"COMPANY_CREATED": {"company.created", "company.audit"}}},
+		TracerProvider: tp,
+		Callbacks: Callbacks{
+			OnSuccess: func(msg *Message, partition int32, offset int64) { sent = append(sent, msg) },
+			OnError:   func(msg *Message, err error) { sent = append(sent, msg) },
+		},
+	}, logger.NewDevelopment())
+
+	// Message carries the trace context of the request which caused it
+	parent, err := trace.Parse("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "")
+	assert.Equal(t, err, nil)
+
+	err = p.Publish(context.Background(), &Message{
+		Name:         "COMPANY_CREATED",
+		PartitionKey: "company-id",
+		Payload:      []byte("payload"),
+		Headers:      map[string]string{trace.TraceParentHeader: parent.TraceParent()},
+	})
+	assert.Equal(t, err, sarama.ErrNotLeaderForPartition)
+	assert.Equal(t, mockProducer.Close(), nil)
+
+	// Every topic is sent in its own span, continuing the trace of the message
+	spans := recorder.Ended()
+	assert.Equal(t, len(spans), 2)
+	assert.Equal(t, len(sent), 2)
+
+	for i, topic := range []string{"company.created", "company.audit"} {
+		span := spans[i]
+		assert.Equal(t, span.Name(), topic+" publish")
+		assert.Equal(t, span.SpanKind(), oteltrace.SpanKindProducer)
+		assert.Equal(t, [16]byte(span.SpanContext().TraceID()), parent.TraceID)
+		assert.Equal(t, [8]byte(span.Parent().SpanID()), parent.ParentID)
+
+		// Sent message identifies the producer span
+		tc, ok := trace.FromHeaders(sent[i].Headers)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, [8]byte(span.SpanContext().SpanID()), tc.ParentID)
+	}
+
+	assert.Equal(t, spans[0].Status().Code, codes.Unset)
+	assert.Equal(t, spans[1].Status().Code, codes.Error)
+}
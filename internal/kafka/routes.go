@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Routes maps the message names to the topics they are published to.
+type Routes struct {
+	// Default is the topic of the messages without a route.
+	Default string
+	// Prefix is prepended to every routed topic, e.g. to separate the environments
+	// sharing the same cluster ("staging.company.commands").
+	Prefix string
+	// Topics maps the message name to one or more topics.
+	// Message routed to several topics is published to each of them.
+	Topics map[string][]string
+}
+
+// Resolve returns the prefixed topics the message with the given name is published to.
+func (r Routes) Resolve(msgName string) ([]string, error) {
+	topics := r.Topics[msgName]
+	if len(topics) == 0 {
+		if r.Default == "" {
+			return nil, fmt.Errorf("no topic configured for message %q", msgName)
+		}
+
+		topics = []string{r.Default}
+	}
+
+	resolved := make([]string, len(topics))
+	for i, topic := range topics {
+		resolved[i] = r.Prefix + topic
+	}
+
+	return resolved, nil
+}
+
+// ParseRoutes parses the routing table in the format
+// "NAME=topic1,topic2;OTHER_NAME=topic3". Empty string returns an empty table.
+func ParseRoutes(s string) (map[string][]string, error) {
+	routes := make(map[string][]string)
+
+	for _, route := range strings.Split(s, ";") {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+
+		name, list, ok := strings.Cut(route, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid route %q, expected NAME=topic[,topic]", route)
+		}
+
+		var topics []string
+		for _, topic := range strings.Split(list, ",") {
+			if topic = strings.TrimSpace(topic); topic != "" {
+				topics = append(topics, topic)
+			}
+		}
+
+		if len(topics) == 0 {
+			return nil, fmt.Errorf("route %q has no topics", name)
+		}
+
+		routes[name] = append(routes[name], topics...)
+	}
+
+	return routes, nil
+}
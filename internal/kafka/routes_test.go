@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{
+			name: "Test ParseRoutes() empty",
+			s:    "",
+			want: map[string][]string{},
+		},
+		{
+			name: "Test ParseRoutes() with fan-out",
+			s:    "COMPANY_CREATED=company.created, company.audit; COMPANY_DELETED=company.deleted",
+			want: map[string][]string{
+				"COMPANY_CREATED": {"company.created", "company.audit"},
+				"COMPANY_DELETED": {"company.deleted"},
+			},
+		},
+		{
+			name:    "Test ParseRoutes() without topic",
+			s:       "COMPANY_CREATED=",
+			wantErr: true,
+		},
+		{
+			name:    "Test ParseRoutes() without name",
+			s:       "company.created",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRoutes(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRoutes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRoutes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutes_Resolve(t *testing.T) {
+	routes := Routes{
+		Default: "company.commands",
+		Prefix:  "staging.",
+		Topics: map[string][]string{
+			"COMPANY_CREATED": {"company.created", "company.audit"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		routes  Routes
+		msgName string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "Test Resolve() routed message",
+			routes:  routes,
+			msgName: "COMPANY_CREATED",
+			want:    []string{"staging.company.created", "staging.company.audit"},
+		},
+		{
+			name:    "Test Resolve() default topic",
+			routes:  routes,
+			msgName: "COMPANY_DELETED",
+			want:    []string{"staging.company.commands"},
+		},
+		{
+			name:    "Test Resolve() without default topic",
+			routes:  Routes{},
+			msgName: "COMPANY_DELETED",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.routes.Resolve(tt.msgName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Routes.Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Routes.Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
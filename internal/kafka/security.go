@@ -0,0 +1,178 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// SecurityConfig configures the connection to a secured cluster.
+// It is shared by the producer and the consumer.
+type SecurityConfig struct {
+	TLS  TLSConfig
+	SASL SASLConfig
+}
+
+// TLSConfig configures TLS of the broker connections.
+type TLSConfig struct {
+	Enabled bool
+	// CAFile is the PEM encoded CA bundle verifying the brokers. System roots are used if it is empty.
+	CAFile string
+	// CertFile and KeyFile are the PEM encoded client certificate and key,
+	// used if the brokers require client authentication. Both or none have to be set.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name the broker certificates are verified against.
+	ServerName string
+}
+
+// SASLConfig configures SASL authentication.
+type SASLConfig struct {
+	// Mechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512. SASL is disabled if it is empty.
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// Validate checks the configuration and loads the TLS certificates,
+// so a misconfiguration is reported at startup.
+func (c SecurityConfig) Validate() error {
+	if _, err := c.TLS.build(); err != nil {
+		return err
+	}
+
+	return c.SASL.validate()
+}
+
+// apply sets the security options on the sarama configuration.
+func (c SecurityConfig) apply(cfg *sarama.Config) error {
+	tlsCfg, err := c.TLS.build()
+	if err != nil {
+		return err
+	}
+
+	if err := c.SASL.validate(); err != nil {
+		return err
+	}
+
+	if tlsCfg != nil {
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsCfg
+	}
+
+	if c.SASL.Mechanism != "" {
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.Mechanism = sarama.SASLMechanism(c.SASL.Mechanism)
+		cfg.Net.SASL.User = c.SASL.Username
+		cfg.Net.SASL.Password = c.SASL.Password
+		// Version 1 wraps the authentication in Kafka requests (Kafka 1.0 or newer).
+		cfg.Net.SASL.Version = sarama.SASLHandshakeV1
+
+		switch c.SASL.Mechanism {
+		case sarama.SASLTypeSCRAMSHA256:
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{hash: scram.SHA256}
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{hash: scram.SHA512}
+			}
+		}
+	}
+
+	return nil
+}
+
+// build loads the certificates and creates the TLS configuration.
+// It returns nil if TLS is disabled.
+func (c TLSConfig) build() (*tls.Config, error) {
+	if !c.Enabled {
+		if c.CAFile != "" || c.CertFile != "" || c.KeyFile != "" || c.ServerName != "" {
+			return nil, errors.New("kafka tls options are set, but tls is disabled")
+		}
+
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading kafka tls ca file: %w", err)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka tls ca file %s contains no certificates", c.CAFile)
+		}
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("kafka tls client certificate and key have to be set together")
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading kafka tls client certificate: %w", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func (c SASLConfig) validate() error {
+	switch c.Mechanism {
+	case "":
+		if c.Username != "" || c.Password != "" {
+			return errors.New("kafka sasl credentials are set, but the sasl mechanism is not")
+		}
+
+		return nil
+	case sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+	default:
+		return fmt.Errorf("unsupported kafka sasl mechanism %q", c.Mechanism)
+	}
+
+	if c.Username == "" || c.Password == "" {
+		return fmt.Errorf("kafka sasl mechanism %s requires the username and password", c.Mechanism)
+	}
+
+	return nil
+}
+
+// scramClient implements sarama.SCRAMClient.
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hash.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+
+	c.conversation = client.NewConversation()
+
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
@@ -0,0 +1,259 @@
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-playground/assert/v2"
+	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/xdg-go/scram"
+)
+
+// testCertificate writes a self-signed certificate for "kafka.test" and its key to the directory.
+// Certificate is its own CA and can be used by both the broker and the client.
+func testCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka.test"},
+		DNSNames:              []string{"kafka.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Equal(t, err, nil)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Equal(t, err, nil)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	assert.Equal(t, err, nil)
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	assert.Equal(t, err, nil)
+
+	return certFile, keyFile
+}
+
+// newTestBroker starts a mock broker on the listener answering the metadata requests.
+func newTestBroker(t *testing.T, listener net.Listener, handlers map[string]sarama.MockResponse) *sarama.MockBroker {
+	broker := sarama.NewMockBrokerListener(t, 1, listener)
+
+	handlers["MetadataRequest"] = sarama.NewMockMetadataResponse(t).
+		SetBroker(broker.Addr(), broker.BrokerID()).
+		SetController(broker.BrokerID())
+	broker.SetHandlerByMap(handlers)
+
+	return broker
+}
+
+func TestSecurityConfig_Validate(t *testing.T) {
+	certFile, keyFile := testCertificate(t, t.TempDir())
+
+	tests := []struct {
+		name     string
+		security SecurityConfig
+		wantErr  bool
+	}{
+		{
+			name: "Test no security is valid",
+		},
+		{
+			name: "Test TLS with CA and client certificate",
+			security: SecurityConfig{TLS: TLSConfig{
+				Enabled:    true,
+				CAFile:     certFile,
+				CertFile:   certFile,
+				KeyFile:    keyFile,
+				ServerName: "kafka.test",
+			}},
+		},
+		{
+			name:     "Test TLS options without enabling TLS",
+			security: SecurityConfig{TLS: TLSConfig{CAFile: certFile}},
+			wantErr:  true,
+		},
+		{
+			name:     "Test missing CA file",
+			security: SecurityConfig{TLS: TLSConfig{Enabled: true, CAFile: "missing.pem"}},
+			wantErr:  true,
+		},
+		{
+			name:     "Test CA file without certificates",
+			security: SecurityConfig{TLS: TLSConfig{Enabled: true, CAFile: keyFile}},
+			wantErr:  true,
+		},
+		{
+			name:     "Test client certificate without key",
+			security: SecurityConfig{TLS: TLSConfig{Enabled: true, CertFile: certFile}},
+			wantErr:  true,
+		},
+		{
+			name:     "Test SCRAM-SHA-512",
+			security: SecurityConfig{SASL: SASLConfig{Mechanism: "SCRAM-SHA-512", Username: "user", Password: "secret"}},
+		},
+		{
+			name:     "Test unsupported SASL mechanism",
+			security: SecurityConfig{SASL: SASLConfig{Mechanism: "GSSAPI", Username: "user", Password: "secret"}},
+			wantErr:  true,
+		},
+		{
+			name:     "Test SASL without password",
+			security: SecurityConfig{SASL: SASLConfig{Mechanism: "PLAIN", Username: "user"}},
+			wantErr:  true,
+		},
+		{
+			name:     "Test SASL credentials without mechanism",
+			security: SecurityConfig{SASL: SASLConfig{Username: "user", Password: "secret"}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.security.Validate()
+			assert.Equal(t, err != nil, tt.wantErr)
+
+			// Valid configuration has to pass the sarama validation as well
+			if err == nil {
+				cfg := sarama.NewConfig()
+				assert.Equal(t, tt.security.apply(cfg), nil)
+				assert.Equal(t, cfg.Validate(), nil)
+			}
+		})
+	}
+}
+
+func TestNewKafkaProducer_TLS(t *testing.T) {
+	certFile, keyFile := testCertificate(t, t.TempDir())
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.Equal(t, err, nil)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, err, nil)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	// Broker requires the client certificate
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	assert.Equal(t, err, nil)
+
+	broker := newTestBroker(t, listener, map[string]sarama.MockResponse{})
+	defer broker.Close()
+
+	security := SecurityConfig{TLS: TLSConfig{
+		Enabled:    true,
+		CAFile:     certFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "kafka.test",
+	}}
+
+	p, err := NewKafkaProducer([]string{broker.Addr()}, ProducerConfig{Security: security}, logger.NewDevelopment())
+	assert.Equal(t, err, nil)
+	p.Close()
+
+	// Broker certificate isn't valid for another server name
+	security.TLS.ServerName = "other.test"
+
+	_, err = NewKafkaProducer([]string{broker.Addr()}, ProducerConfig{Security: security}, logger.NewDevelopment())
+	assert.NotEqual(t, err, nil)
+}
+
+func TestNewKafkaProducer_SASLPlain(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+
+	broker := newTestBroker(t, listener, map[string]sarama.MockResponse{
+		"SaslHandshakeRequest":    sarama.NewMockSaslHandshakeResponse(t).SetEnabledMechanisms([]string{sarama.SASLTypePlaintext}),
+		"SaslAuthenticateRequest": sarama.NewMockSaslAuthenticateResponse(t),
+	})
+	defer broker.Close()
+
+	security := SecurityConfig{SASL: SASLConfig{Mechanism: "PLAIN", Username: "user", Password: "secret"}}
+
+	p, err := NewKafkaProducer([]string{broker.Addr()}, ProducerConfig{Security: security}, logger.NewDevelopment())
+	assert.Equal(t, err, nil)
+	p.Close()
+
+	// Consumer authenticates the same way
+	c, err := NewKafkaConsumer([]string{broker.Addr()}, "test", []string{"company.commands"}, security, nil, "", logger.NewDevelopment())
+	assert.Equal(t, err, nil)
+	c.Close()
+
+	var auth [][]byte
+	for _, rr := range broker.History() {
+		if req, ok := rr.Request.(*sarama.SaslAuthenticateRequest); ok {
+			auth = append(auth, req.SaslAuthBytes)
+		}
+	}
+
+	assert.Equal(t, len(auth), 2)
+	assert.Equal(t, string(auth[0]), "\x00user\x00secret")
+}
+
+func Test_scramClient(t *testing.T) {
+	for _, hash := range []scram.HashGeneratorFcn{scram.SHA256, scram.SHA512} {
+		client := &scramClient{hash: hash}
+
+		kf := scram.KeyFactors{Salt: "salt", Iters: 4096}
+
+		server, err := hash.NewServer(func(user string) (scram.StoredCredentials, error) {
+			c, err := hash.NewClient("user", "secret", "")
+			if err != nil {
+				return scram.StoredCredentials{}, err
+			}
+
+			return c.GetStoredCredentials(kf), nil
+		})
+		assert.Equal(t, err, nil)
+
+		conversation := server.NewConversation()
+
+		err = client.Begin("user", "secret", "")
+		assert.Equal(t, err, nil)
+
+		// Exchange the messages until the client verified the server
+		challenge := ""
+		for !client.Done() {
+			msg, err := client.Step(challenge)
+			assert.Equal(t, err, nil)
+
+			if client.Done() {
+				break
+			}
+
+			challenge, err = conversation.Step(msg)
+			assert.Equal(t, err, nil)
+		}
+
+		assert.Equal(t, conversation.Valid(), true)
+	}
+}
@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the producer spans.
+const tracerName = "github.com/kperanovic/epam-systems/internal/kafka"
+
+// produced is the metadata of a sent sarama message, used to report its delivery.
+type produced struct {
+	msg  *Message
+	span oteltrace.Span
+	// acked receives the delivery result if the publisher waits for it.
+	// Failed messages with a waiting publisher aren't spooled.
+	acked chan<- error
+}
+
+// startSpan starts the producer span of the message sent to the topic.
+func (p *Producer) startSpan(ctx context.Context, topic string, msg *Message) (context.Context, oteltrace.Span) {
+	return p.tracer.Start(ctx, topic+" publish",
+		oteltrace.WithSpanKind(oteltrace.SpanKindProducer),
+		oteltrace.WithAttributes(
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingKafkaMessageKey(msg.PartitionKey),
+			attribute.String("messaging.message.name", msg.Name),
+		),
+	)
+}
+
+// endSpan records the delivery result and ends the producer span.
+func endSpan(span oteltrace.Span, partition int32, offset int64, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(
+			semconv.MessagingKafkaDestinationPartition(int(partition)),
+			semconv.MessagingKafkaMessageOffset(int(offset)),
+		)
+	}
+
+	span.End()
+}
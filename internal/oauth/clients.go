@@ -0,0 +1,179 @@
+// Package oauth implements the registry of the OAuth2 clients
+// allowed to request access tokens with the client credentials grant (RFC 6749, section 4.4).
+// Client secrets are never stored, only their bcrypt hashes.
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultTokenTTL is the default lifetime of the issued access tokens.
+const DefaultTokenTTL = 15 * time.Minute
+
+var (
+	// ErrInvalidClient is returned when the client is unknown or the secret doesn't match.
+	ErrInvalidClient = errors.New("invalid client credentials")
+	// ErrInvalidScope is returned when the client requests a scope it isn't allowed.
+	ErrInvalidScope = errors.New("requested scope is not allowed")
+)
+
+// Client is a registered OAuth2 client.
+type Client struct {
+	// ID is the client id. It is a UUID, used as the user id of the issued tokens.
+	ID   string `mapstructure:"id"`
+	Name string `mapstructure:"name"`
+	// SecretHash is the bcrypt hash of the client secret.
+	SecretHash string `mapstructure:"secret_hash"`
+	// Scopes are the scopes the client is allowed to request.
+	Scopes []string `mapstructure:"scopes"`
+	// TokenTTL is the lifetime of the tokens issued to the client. Registry default is used if it is zero.
+	TokenTTL time.Duration `mapstructure:"token_ttl"`
+
+	userID uuid.UUID
+}
+
+// UserID returns the id the tokens of the client are issued for.
+func (c *Client) UserID() uuid.UUID {
+	return c.userID
+}
+
+// Grant returns the scopes granted for the requested ones.
+// All allowed scopes are granted if none are requested.
+func (c *Client) Grant(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return c.Scopes, nil
+	}
+
+	allowed := make(map[string]bool, len(c.Scopes))
+	for _, scope := range c.Scopes {
+		allowed[scope] = true
+	}
+
+	for _, scope := range requested {
+		if !allowed[scope] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+
+	return requested, nil
+}
+
+// Registry holds the registered clients.
+type Registry struct {
+	clients map[string]*Client
+	// maxTTL is the longest token lifetime of the clients.
+	maxTTL time.Duration
+	// dummyHash is compared against the secret of unknown clients,
+	// so the response time doesn't tell whether the client exists.
+	dummyHash []byte
+}
+
+// NewRegistry validates the clients and creates the registry.
+// Clients without a token lifetime get the default one.
+func NewRegistry(clients []Client, defaultTTL time.Duration) (*Registry, error) {
+	if defaultTTL <= 0 {
+		defaultTTL = DefaultTokenTTL
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy-secret"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registry{
+		clients:   make(map[string]*Client, len(clients)),
+		maxTTL:    defaultTTL,
+		dummyHash: dummyHash,
+	}
+
+	for i := range clients {
+		c := clients[i]
+
+		if c.userID, err = uuid.Parse(c.ID); err != nil {
+			return nil, fmt.Errorf("oauth client id %q is not a valid uuid", c.ID)
+		}
+
+		// Client id is compared in its canonical form.
+		c.ID = c.userID.String()
+
+		if _, ok := r.clients[c.ID]; ok {
+			return nil, fmt.Errorf("oauth client %s is registered twice", c.ID)
+		}
+
+		if _, err := bcrypt.Cost([]byte(c.SecretHash)); err != nil {
+			return nil, fmt.Errorf("oauth client %s secret hash is not a bcrypt hash: %w", c.ID, err)
+		}
+
+		if c.TokenTTL < 0 {
+			return nil, fmt.Errorf("oauth client %s token ttl is negative", c.ID)
+		}
+
+		if c.TokenTTL == 0 {
+			c.TokenTTL = defaultTTL
+		}
+
+		if c.TokenTTL > r.maxTTL {
+			r.maxTTL = c.TokenTTL
+		}
+
+		r.clients[c.ID] = &c
+	}
+
+	return r, nil
+}
+
+// LoadRegistry reads the clients from the "clients" list of the JSON or YAML file.
+func LoadRegistry(path string, defaultTTL time.Duration) (*Registry, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading oauth clients file: %w", err)
+	}
+
+	var clients []Client
+	if err := v.UnmarshalKey("clients", &clients); err != nil {
+		return nil, fmt.Errorf("error decoding oauth clients file: %w", err)
+	}
+
+	return NewRegistry(clients, defaultTTL)
+}
+
+// MaxTokenTTL returns the longest lifetime of the tokens issued to the clients.
+// It is never shorter than the default lifetime.
+func (r *Registry) MaxTokenTTL() time.Duration {
+	return r.maxTTL
+}
+
+// Client returns the registered client with the given id.
+func (r *Registry) Client(id uuid.UUID) (*Client, bool) {
+	c, ok := r.clients[id.String()]
+
+	return c, ok
+}
+
+// Authenticate returns the client if the secret matches its hash.
+func (r *Registry) Authenticate(id, secret string) (*Client, error) {
+	var c *Client
+	if uid, err := uuid.Parse(id); err == nil {
+		c = r.clients[uid.String()]
+	}
+
+	if c == nil {
+		_ = bcrypt.CompareHashAndPassword(r.dummyHash, []byte(secret))
+
+		return nil, ErrInvalidClient
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(c.SecretHash), []byte(secret)); err != nil {
+		return nil, ErrInvalidClient
+	}
+
+	return c, nil
+}
@@ -0,0 +1,125 @@
+package oauth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testClientID = "9b2f6a3e-58a4-4a8e-9d55-3f0d7f1c2b61"
+
+func testHash(t *testing.T, secret string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	assert.Equal(t, err, nil)
+
+	return string(hash)
+}
+
+func TestLoadRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.yaml")
+
+	err := os.WriteFile(path, []byte(`
+clients:
+  - id: `+testClientID+`
+    name: reporting
+    secret_hash: "`+testHash(t, "secret")+`"
+    scopes: [company:read, company:write]
+    token_ttl: 5m
+  - id: 6f0e2d8c-0a51-4c39-bb1e-2a9a3c6d7e80
+    name: audit
+    secret_hash: "`+testHash(t, "other")+`"
+`), 0o600)
+	assert.Equal(t, err, nil)
+
+	r, err := LoadRegistry(path, time.Hour)
+	assert.Equal(t, err, nil)
+
+	c, err := r.Authenticate(testClientID, "secret")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, c.Name, "reporting")
+	assert.Equal(t, c.UserID().String(), testClientID)
+	assert.Equal(t, c.TokenTTL, 5*time.Minute)
+
+	// Client without a token lifetime gets the default one
+	c, err = r.Authenticate("6F0E2D8C-0A51-4C39-BB1E-2A9A3C6D7E80", "other")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, c.TokenTTL, time.Hour)
+	assert.Equal(t, r.MaxTokenTTL(), time.Hour)
+
+	_, err = r.Authenticate(testClientID, "other")
+	assert.Equal(t, err, ErrInvalidClient)
+
+	_, err = r.Authenticate("unknown", "secret")
+	assert.Equal(t, err, ErrInvalidClient)
+}
+
+func TestNewRegistry_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients []Client
+	}{
+		{
+			name:    "Test client id is not a uuid",
+			clients: []Client{{ID: "reporting", SecretHash: testHash(t, "secret")}},
+		},
+		{
+			name: "Test duplicated client",
+			clients: []Client{
+				{ID: testClientID, SecretHash: testHash(t, "secret")},
+				{ID: testClientID, SecretHash: testHash(t, "secret")},
+			},
+		},
+		{
+			name:    "Test plain text secret",
+			clients: []Client{{ID: testClientID, SecretHash: "secret"}},
+		},
+		{
+			name:    "Test negative token ttl",
+			clients: []Client{{ID: testClientID, SecretHash: testHash(t, "secret"), TokenTTL: -time.Minute}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(tt.clients, 0)
+			assert.NotEqual(t, err, nil)
+		})
+	}
+}
+
+func TestClient_Grant(t *testing.T) {
+	c := &Client{Scopes: []string{"company:read", "company:write"}}
+
+	tests := []struct {
+		name      string
+		requested []string
+		want      []string
+		wantErr   error
+	}{
+		{
+			name: "Test all allowed scopes are granted by default",
+			want: []string{"company:read", "company:write"},
+		},
+		{
+			name:      "Test subset of the allowed scopes",
+			requested: []string{"company:read"},
+			want:      []string{"company:read"},
+		},
+		{
+			name:      "Test scope which isn't allowed",
+			requested: []string{"company:read", "company:admin"},
+			wantErr:   ErrInvalidScope,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Grant(tt.requested)
+			assert.Equal(t, errors.Is(err, tt.wantErr), true)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
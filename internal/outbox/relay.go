@@ -0,0 +1,192 @@
+// Package outbox implements the relay which publishes
+// the messages stored in the transactional outbox to Kafka.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/kperanovic/epam-systems/internal/kafka"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultInterval is the default time between two outbox polls.
+	DefaultInterval = time.Second
+	// DefaultBatchSize is the default number of messages published in one poll.
+	DefaultBatchSize = 100
+)
+
+// Publisher publishes a single message. It is implemented by kafka.Producer.
+type Publisher interface {
+	Publish(ctx context.Context, msg *kafka.Message) error
+}
+
+// BatchPublisher publishes several messages at once and returns the number of published messages.
+// It is implemented by kafka.Producer, which publishes the batch atomically if it is transactional.
+type BatchPublisher interface {
+	PublishBatch(ctx context.Context, msgs []*kafka.Message) (int, error)
+}
+
+// Relay periodically reads the pending outbox messages, publishes them
+// and marks them as delivered. Messages are published one by one in the order
+// they were stored. On failure the relay stops and retries from the failed message
+// with an exponential backoff, so the order of the messages is kept.
+//
+// Publishers implementing BatchPublisher get the whole batch at once, so a transactional
+// producer commits all events of the batch atomically.
+//
+// Delivery is at least once: a message can be published again if marking it
+// as delivered fails, so consumers should deduplicate by the event id
+// sent in the kafka.EventIDHeader.
+type Relay struct {
+	log       *zap.Logger
+	outbox    storage.Outbox
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+	backoff   backoff.BackOff
+}
+
+// NewRelay creates a new outbox relay.
+// Zero interval and batch size are replaced with the defaults.
+func NewRelay(log *zap.Logger, outbox storage.Outbox, publisher Publisher, interval time.Duration, batchSize int) *Relay {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	b := backoff.NewExponentialBackOff()
+	// Keep retrying for as long as the broker is unavailable.
+	b.MaxElapsedTime = 0
+
+	return &Relay{
+		log:       log,
+		outbox:    outbox,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+		backoff:   b,
+	}
+}
+
+// Run polls the outbox until the context is done.
+func (r *Relay) Run(ctx context.Context) {
+	r.log.Info("starting outbox relay", zap.Duration("interval", r.interval), zap.Int("batchSize", r.batchSize))
+
+	for {
+		delay := r.interval
+
+		n, err := r.Flush(ctx)
+		switch {
+		case err != nil:
+			delay = r.backoff.NextBackOff()
+
+			r.log.Error("error publishing outbox messages", zap.Error(err), zap.Duration("retryIn", delay))
+		case n == r.batchSize:
+			// Full batch was published, there are probably more messages waiting.
+			r.backoff.Reset()
+			delay = 0
+		default:
+			r.backoff.Reset()
+		}
+
+		select {
+		case <-ctx.Done():
+			r.log.Info("stopping outbox relay")
+
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Flush publishes a single batch of pending messages.
+// It returns the number of published messages and stops at the first failure.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	msgs, err := r.outbox.PendingMessages(r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	if batch, ok := r.publisher.(BatchPublisher); ok {
+		return r.flushBatch(ctx, batch, msgs)
+	}
+
+	for i, msg := range msgs {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+
+		if err := r.publisher.Publish(ctx, toKafkaMessage(msg)); err != nil {
+			r.markFailed(msg, err)
+
+			return i, err
+		}
+
+		if err := r.outbox.MarkDelivered(msg.ID); err != nil {
+			return i, err
+		}
+	}
+
+	return len(msgs), nil
+}
+
+// flushBatch publishes the messages as a single batch and marks the published ones as delivered.
+func (r *Relay) flushBatch(ctx context.Context, publisher BatchPublisher, msgs []*storage.OutboxMessage) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	batch := make([]*kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		batch[i] = toKafkaMessage(msg)
+	}
+
+	n, pubErr := publisher.PublishBatch(ctx, batch)
+
+	for i, msg := range msgs[:n] {
+		if err := r.outbox.MarkDelivered(msg.ID); err != nil {
+			return i, err
+		}
+	}
+
+	if pubErr != nil {
+		r.markFailed(msgs[n], pubErr)
+
+		return n, pubErr
+	}
+
+	return n, nil
+}
+
+// markFailed records the failed attempt and logs an error if it happened.
+func (r *Relay) markFailed(msg *storage.OutboxMessage, cause error) {
+	if err := r.outbox.MarkFailed(msg.ID, cause); err != nil {
+		r.log.Error("error marking outbox message as failed", zap.Uint64("id", msg.ID), zap.Error(err))
+	}
+}
+
+// toKafkaMessage converts the outbox message to the message sent by the producer.
+// Event id is sent in the kafka.EventIDHeader.
+func toKafkaMessage(msg *storage.OutboxMessage) *kafka.Message {
+	headers := make(map[string]string, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	headers[kafka.EventIDHeader] = msg.EventID.String()
+
+	return &kafka.Message{
+		Topic:        msg.Topic,
+		PartitionKey: msg.Key,
+		Name:         msg.Name,
+		Payload:      msg.Payload,
+		Headers:      headers,
+	}
+}
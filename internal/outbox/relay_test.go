@@ -0,0 +1,152 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+	"github.com/kperanovic/epam-systems/internal/kafka"
+	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/storage"
+)
+
+// fakePublisher records the published messages and fails once failAfter messages were published.
+type fakePublisher struct {
+	published []*kafka.Message
+	failAfter int
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, msg *kafka.Message) error {
+	if p.failAfter >= 0 && len(p.published) == p.failAfter {
+		return errors.New("broker unavailable")
+	}
+
+	p.published = append(p.published, msg)
+
+	return nil
+}
+
+// fakeBatchPublisher publishes the batches atomically, like a transactional producer.
+type fakeBatchPublisher struct {
+	fakePublisher
+	batches int
+}
+
+func (p *fakeBatchPublisher) PublishBatch(ctx context.Context, msgs []*kafka.Message) (int, error) {
+	if p.failAfter >= 0 && len(p.published)+len(msgs) > p.failAfter {
+		return 0, errors.New("transaction aborted")
+	}
+
+	p.published = append(p.published, msgs...)
+	p.batches++
+
+	return len(msgs), nil
+}
+
+// saveCompanies stores n companies, each writing a created event into the outbox.
+func saveCompanies(t *testing.T, store storage.Storage, n int) {
+	event := func(before, after *types.Company) (*storage.OutboxMessage, error) {
+		return &storage.OutboxMessage{
+			Topic: "company.commands",
+			Key:   after.ID.String(),
+			Name:  "COMPANY_CREATED",
+		}, nil
+	}
+
+	for i := 0; i < n; i++ {
+		company := &types.Company{ID: uuid.New(), Name: "test-company", CompanyType: 1}
+
+		err := store.SaveCompany(context.Background(), company, event)
+		assert.Equal(t, err, nil)
+	}
+}
+
+func TestRelay_Flush(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	saveCompanies(t, store, 3)
+
+	publisher := &fakePublisher{failAfter: -1}
+	relay := NewRelay(logger.NewDevelopment(), store, publisher, 0, 2)
+
+	// First flush publishes a full batch
+	n, err := relay.Flush(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 2)
+
+	// Second flush publishes the rest
+	n, err = relay.Flush(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 1)
+
+	assert.Equal(t, len(publisher.published), 3)
+	assert.Equal(t, publisher.published[0].Name, "COMPANY_CREATED")
+	assert.Equal(t, publisher.published[0].Topic, "company.commands")
+
+	// Event id is sent in the header, so consumers can deduplicate the events
+	_, err = uuid.Parse(publisher.published[0].Headers[kafka.EventIDHeader])
+	assert.Equal(t, err, nil)
+
+	stats, err := store.OutboxStats()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, stats.Pending, int64(0))
+}
+
+func TestRelay_Flush_Failure(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	saveCompanies(t, store, 3)
+
+	publisher := &fakePublisher{failAfter: 1}
+	relay := NewRelay(logger.NewDevelopment(), store, publisher, 0, 10)
+
+	// Relay stops at the failed message, so the order is kept
+	n, err := relay.Flush(context.Background())
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, n, 1)
+
+	pending, err := store.PendingMessages(10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(pending), 2)
+	assert.Equal(t, pending[0].Attempts, 1)
+	assert.Equal(t, pending[0].LastError, "broker unavailable")
+
+	// Once the broker is back, the rest is published
+	publisher.failAfter = -1
+
+	n, err = relay.Flush(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 2)
+	assert.Equal(t, len(publisher.published), 3)
+}
+
+func TestRelay_Flush_Batch(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	saveCompanies(t, store, 3)
+
+	publisher := &fakeBatchPublisher{fakePublisher: fakePublisher{failAfter: 1}}
+	relay := NewRelay(logger.NewDevelopment(), store, publisher, 0, 10)
+
+	// Failed batch is not published at all
+	n, err := relay.Flush(context.Background())
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, n, 0)
+
+	pending, err := store.PendingMessages(10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(pending), 3)
+	assert.Equal(t, pending[0].Attempts, 1)
+
+	publisher.failAfter = -1
+
+	// All pending messages are published in one batch
+	n, err = relay.Flush(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 3)
+	assert.Equal(t, publisher.batches, 1)
+
+	stats, err := store.OutboxStats()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, stats.Pending, int64(0))
+}
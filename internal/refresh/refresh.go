@@ -0,0 +1,260 @@
+// Package refresh issues and rotates the refresh tokens, which are exchanged for new
+// access tokens, so clients don't have to authenticate with their secret again.
+package refresh
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTTL is the default lifetime of a refresh token.
+	DefaultTTL = 7 * 24 * time.Hour
+	// DefaultPruneInterval is the default time between two prunes of the expired refresh tokens.
+	DefaultPruneInterval = time.Hour
+
+	// tokenSize is the number of random bytes in a refresh token.
+	tokenSize = 32
+)
+
+var (
+	// ErrInvalidToken is returned for unknown, expired and revoked refresh tokens.
+	ErrInvalidToken = errors.New("refresh token is invalid")
+	// ErrTokenReused is returned when a spent refresh token is used again.
+	// The whole token family is revoked in that case.
+	ErrTokenReused = errors.New("refresh token has already been used")
+)
+
+// GrantFunc checks the refresh of the current token and returns the scopes of the new access token.
+// Returning an error aborts the rotation, the token isn't spent and the error is returned unchanged.
+type GrantFunc func(current *storage.RefreshToken) ([]string, error)
+
+// Rotation is the result of a refresh token rotation.
+type Rotation struct {
+	// Token is the successor of the spent token, Raw is its value sent to the client.
+	Token *storage.RefreshToken
+	Raw   string
+	// Scopes are granted to the new access token.
+	Scopes []string
+}
+
+// AccessRevoker revokes the access tokens of a user. It is implemented by revocation.List.
+type AccessRevoker interface {
+	RevokeUser(ctx context.Context, userID uuid.UUID) error
+}
+
+// Manager issues the refresh tokens and rotates them on every use.
+// Tokens are random strings, only their hashes are stored.
+// Tokens issued by rotation belong to the same family as the spent token,
+// and reusing a spent token revokes the whole family, since either the client
+// or an attacker holds a stolen token.
+type Manager struct {
+	log      *zap.Logger
+	store    storage.RefreshTokens
+	revoker  AccessRevoker
+	ttl      time.Duration
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewManager creates a new refresh token manager.
+// Zero ttl and interval are replaced with the defaults.
+func NewManager(log *zap.Logger, store storage.RefreshTokens, ttl, interval time.Duration) *Manager {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	if interval <= 0 {
+		interval = DefaultPruneInterval
+	}
+
+	return &Manager{
+		log:      log,
+		store:    store,
+		ttl:      ttl,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// WithRevoker revokes the access tokens of the client as well when a spent refresh token is reused.
+// Access tokens don't record the family they were issued from,
+// so every access token the client was issued so far is revoked.
+func (m *Manager) WithRevoker(revoker AccessRevoker) *Manager {
+	m.revoker = revoker
+
+	return m
+}
+
+// Issue creates the first refresh token of a new family.
+func (m *Manager) Issue(ctx context.Context, userID uuid.UUID, name string, scopes []string) (string, error) {
+	token := &storage.RefreshToken{
+		FamilyID: uuid.New(),
+		UserID:   userID,
+		Name:     name,
+		Scope:    strings.Join(scopes, " "),
+	}
+
+	raw, err := m.generate(token)
+	if err != nil {
+		return "", err
+	}
+
+	if err := m.store.SaveRefreshToken(ctx, token); err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// Rotate spends the refresh token and issues its successor in the same family.
+// Both are stored at once, so a failed rotation doesn't spend the token without a successor.
+// The successor keeps the scope of the family, the scopes of the access token are returned by grant.
+func (m *Manager) Rotate(ctx context.Context, raw string, grant GrantFunc) (*Rotation, error) {
+	current, err := m.Lookup(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.UsedAt != nil {
+		return nil, m.reused(ctx, current)
+	}
+
+	scopes, err := grant(current)
+	if err != nil {
+		return nil, err
+	}
+
+	next := &storage.RefreshToken{
+		FamilyID: current.FamilyID,
+		UserID:   current.UserID,
+		Name:     current.Name,
+		Scope:    current.Scope,
+	}
+
+	nextRaw, err := m.generate(next)
+	if err != nil {
+		return nil, err
+	}
+
+	switch err := m.store.RotateRefreshToken(ctx, current.Hash, m.now(), next); {
+	case errors.Is(err, storage.ErrConflict):
+		// Token was spent or revoked by a concurrent request.
+		return nil, m.reused(ctx, current)
+	case err != nil:
+		return nil, err
+	}
+
+	return &Rotation{Token: next, Raw: nextRaw, Scopes: scopes}, nil
+}
+
+// Lookup returns the stored refresh token. Unknown, expired and revoked tokens return ErrInvalidToken.
+// Spent tokens are returned, so they can be revoked.
+func (m *Manager) Lookup(ctx context.Context, raw string) (*storage.RefreshToken, error) {
+	token, err := m.store.GetRefreshToken(ctx, hashToken(raw))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if token.RevokedAt != nil || !m.now().Before(token.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	return token, nil
+}
+
+// RevokeFamily revokes the family of the refresh token.
+func (m *Manager) RevokeFamily(ctx context.Context, token *storage.RefreshToken) error {
+	return m.store.RevokeRefreshFamily(ctx, token.FamilyID, m.now())
+}
+
+// RevokeUser revokes every refresh token of the user.
+func (m *Manager) RevokeUser(ctx context.Context, userID uuid.UUID) error {
+	return m.store.RevokeUserRefreshTokens(ctx, userID, m.now())
+}
+
+// Run prunes the expired refresh tokens until the context is done.
+func (m *Manager) Run(ctx context.Context) {
+	m.log.Info("starting refresh token pruning", zap.Duration("interval", m.interval))
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.log.Info("stopping refresh token pruning")
+
+			return
+		case <-ticker.C:
+			pruned, err := m.store.PruneRefreshTokens(ctx, m.now())
+			if err != nil {
+				m.log.Error("error pruning refresh tokens", zap.Error(err))
+
+				continue
+			}
+
+			if pruned > 0 {
+				m.log.Debug("pruned expired refresh tokens", zap.Int64("count", pruned))
+			}
+		}
+	}
+}
+
+// reused revokes the family of the spent token, together with the access tokens
+// issued from it if the revoker is set, and returns ErrTokenReused.
+func (m *Manager) reused(ctx context.Context, token *storage.RefreshToken) error {
+	m.log.Warn("refresh token reused, revoking its family",
+		zap.Stringer("familyId", token.FamilyID),
+		zap.Stringer("userId", token.UserID),
+	)
+
+	if err := m.RevokeFamily(ctx, token); err != nil {
+		return err
+	}
+
+	if m.revoker != nil {
+		if err := m.revoker.RevokeUser(ctx, token.UserID); err != nil {
+			return err
+		}
+	}
+
+	return ErrTokenReused
+}
+
+// generate generates the token value and sets the hash and the expiration of the token.
+func (m *Manager) generate(token *storage.RefreshToken) (string, error) {
+	b := make([]byte, tokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	raw := base64.RawURLEncoding.EncodeToString(b)
+
+	token.Hash = hashToken(raw)
+	token.ExpiresAt = m.now().Add(m.ttl)
+
+	return raw, nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of the token.
+// Tokens are random, so a fast hash without a salt is enough.
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+
+	return hex.EncodeToString(sum[:])
+}
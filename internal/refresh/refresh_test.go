@@ -0,0 +1,107 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"go.uber.org/zap"
+)
+
+// grantAll grants the scopes of the refresh token family.
+func grantAll(current *storage.RefreshToken) ([]string, error) {
+	return []string{current.Scope}, nil
+}
+
+func TestManager_Rotate(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(zap.NewNop(), storage.NewMemoryStorage(), time.Hour, 0)
+
+	userID := uuid.New()
+
+	first, err := m.Issue(ctx, userID, "reporting", []string{"company:read"})
+	assert.Equal(t, err, nil)
+
+	rotation, err := m.Rotate(ctx, first, grantAll)
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, rotation.Raw, first)
+	assert.Equal(t, rotation.Token.UserID, userID)
+	assert.Equal(t, rotation.Token.Name, "reporting")
+	assert.Equal(t, rotation.Scopes, []string{"company:read"})
+
+	// Successor is rotated again
+	second, err := m.Rotate(ctx, rotation.Raw, grantAll)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, second.Token.FamilyID, rotation.Token.FamilyID)
+
+	// Reusing the spent token revokes the whole family
+	_, err = m.Rotate(ctx, first, grantAll)
+	assert.Equal(t, err, ErrTokenReused)
+
+	_, err = m.Rotate(ctx, second.Raw, grantAll)
+	assert.Equal(t, err, ErrInvalidToken)
+
+	// Other families of the user aren't affected
+	other, err := m.Issue(ctx, userID, "reporting", nil)
+	assert.Equal(t, err, nil)
+
+	_, err = m.Rotate(ctx, other, grantAll)
+	assert.Equal(t, err, nil)
+
+	_, err = m.Rotate(ctx, "unknown", grantAll)
+	assert.Equal(t, err, ErrInvalidToken)
+}
+
+func TestManager_Rotate_Rejected(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(zap.NewNop(), storage.NewMemoryStorage(), time.Hour, 0)
+
+	raw, err := m.Issue(ctx, uuid.New(), "reporting", nil)
+	assert.Equal(t, err, nil)
+
+	// Rejected grant doesn't spend the token
+	errRejected := errors.New("rejected")
+	_, err = m.Rotate(ctx, raw, func(*storage.RefreshToken) ([]string, error) { return nil, errRejected })
+	assert.Equal(t, err, errRejected)
+
+	_, err = m.Rotate(ctx, raw, grantAll)
+	assert.Equal(t, err, nil)
+}
+
+func TestManager_Expired(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(zap.NewNop(), storage.NewMemoryStorage(), time.Hour, 0)
+
+	raw, err := m.Issue(ctx, uuid.New(), "reporting", nil)
+	assert.Equal(t, err, nil)
+
+	m.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	_, err = m.Rotate(ctx, raw, grantAll)
+	assert.Equal(t, err, ErrInvalidToken)
+}
+
+func TestManager_RevokeUser(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(zap.NewNop(), storage.NewMemoryStorage(), time.Hour, 0)
+
+	userID := uuid.New()
+
+	raw, err := m.Issue(ctx, userID, "reporting", nil)
+	assert.Equal(t, err, nil)
+
+	other, err := m.Issue(ctx, uuid.New(), "audit", nil)
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, m.RevokeUser(ctx, userID), nil)
+
+	_, err = m.Rotate(ctx, raw, grantAll)
+	assert.Equal(t, err, ErrInvalidToken)
+
+	_, err = m.Rotate(ctx, other, grantAll)
+	assert.Equal(t, err, nil)
+}
@@ -0,0 +1,110 @@
+// Package revocation keeps the list of access tokens revoked before their expiry.
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"github.com/kperanovic/epam-systems/internal/token"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPruneInterval is the default time between two prunes of the expired revocations.
+	DefaultPruneInterval = time.Hour
+	// DefaultMaxTokenAge is the default age after which the tokens are rejected.
+	DefaultMaxTokenAge = 24 * time.Hour
+)
+
+// List records the revoked tokens in the storage. Revocations are kept
+// until the revoked tokens expire and are pruned periodically by Run.
+type List struct {
+	log   *zap.Logger
+	store storage.Revocations
+	// maxTTL is the longest accepted lifetime of a token.
+	// User revocations are kept for that long, and older tokens are rejected,
+	// since the revocations covering them might have been pruned.
+	maxTTL   time.Duration
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewList creates a new revocation list.
+// Zero interval is replaced with the DefaultPruneInterval.
+func NewList(log *zap.Logger, store storage.Revocations, maxTTL, interval time.Duration) *List {
+	if interval <= 0 {
+		interval = DefaultPruneInterval
+	}
+
+	return &List{
+		log:      log,
+		store:    store,
+		maxTTL:   maxTTL,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Revoke revokes the token until it expires. Expired tokens are ignored.
+func (l *List) Revoke(ctx context.Context, payload *token.Payload) error {
+	if !payload.ExpiredAt.After(l.now()) {
+		return nil
+	}
+
+	return l.store.RevokeToken(ctx, &storage.RevokedToken{
+		TokenID:   payload.ID,
+		UserID:    payload.UserID,
+		ExpiresAt: payload.ExpiredAt,
+	})
+}
+
+// RevokeUser revokes every token issued to the user so far.
+func (l *List) RevokeUser(ctx context.Context, userID uuid.UUID) error {
+	now := l.now()
+
+	return l.store.RevokeUser(ctx, &storage.RevokedUser{
+		UserID:        userID,
+		RevokedBefore: now,
+		ExpiresAt:     now.Add(l.maxTTL),
+	})
+}
+
+// IsRevoked checks if the token was revoked by itself or together with the other tokens of its user.
+// Tokens issued more than maxTTL ago are reported as revoked.
+func (l *List) IsRevoked(ctx context.Context, payload *token.Payload) (bool, error) {
+	if payload.IssuedAt.Before(l.now().Add(-l.maxTTL)) {
+		return true, nil
+	}
+
+	return l.store.IsRevoked(ctx, payload.ID, payload.UserID, payload.IssuedAt)
+}
+
+// Run prunes the expired revocations until the context is done.
+func (l *List) Run(ctx context.Context) {
+	l.log.Info("starting revocation list pruning", zap.Duration("interval", l.interval))
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.log.Info("stopping revocation list pruning")
+
+			return
+		case <-ticker.C:
+			pruned, err := l.store.PruneRevocations(ctx, l.now())
+			if err != nil {
+				l.log.Error("error pruning revocations", zap.Error(err))
+
+				continue
+			}
+
+			if pruned > 0 {
+				l.log.Debug("pruned expired revocations", zap.Int64("count", pruned))
+			}
+		}
+	}
+}
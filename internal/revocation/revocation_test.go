@@ -0,0 +1,61 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/internal/storage"
+	"github.com/kperanovic/epam-systems/internal/token"
+	"go.uber.org/zap"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	l := NewList(zap.NewNop(), storage.NewMemoryStorage(), time.Hour, 0)
+	l.now = func() time.Time { return now }
+
+	payload := func(userID uuid.UUID, issuedAt time.Time) *token.Payload {
+		return &token.Payload{
+			ID:        uuid.New(),
+			UserID:    userID,
+			IssuedAt:  issuedAt,
+			ExpiredAt: issuedAt.Add(15 * time.Minute),
+		}
+	}
+
+	isRevoked := func(p *token.Payload) bool {
+		revoked, err := l.IsRevoked(ctx, p)
+		assert.Equal(t, err, nil)
+
+		return revoked
+	}
+
+	userID := uuid.New()
+
+	// Single token revocation leaves the other user tokens valid
+	revoked := payload(userID, now.Add(-time.Minute))
+	other := payload(userID, now.Add(-time.Minute))
+
+	assert.Equal(t, l.Revoke(ctx, revoked), nil)
+	assert.Equal(t, isRevoked(revoked), true)
+	assert.Equal(t, isRevoked(other), false)
+
+	// Expired tokens aren't stored
+	expired := payload(userID, now.Add(-time.Hour))
+	assert.Equal(t, l.Revoke(ctx, expired), nil)
+	assert.Equal(t, isRevoked(expired), false)
+
+	// User revocation revokes the tokens issued before it
+	assert.Equal(t, l.RevokeUser(ctx, userID), nil)
+	assert.Equal(t, isRevoked(other), true)
+	assert.Equal(t, isRevoked(payload(userID, now.Add(time.Second))), false)
+	assert.Equal(t, isRevoked(payload(uuid.New(), now.Add(-time.Minute))), false)
+
+	// Tokens older than the user revocations are kept for are rejected
+	assert.Equal(t, isRevoked(payload(uuid.New(), now.Add(-2*time.Hour))), true)
+}
@@ -0,0 +1,458 @@
+// Package spool implements a disk backed spool of the Kafka messages
+// which failed to be published. Spooled messages are replayed
+// once the broker is available again.
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	ccid "github.com/kperanovic/epam-systems/internal/cid"
+	"github.com/kperanovic/epam-systems/internal/kafka"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultInterval is the default time between two replays of the spool.
+	DefaultInterval = 5 * time.Second
+	// DefaultMaxBytes is the default size limit of the messages waiting in the spool.
+	DefaultMaxBytes = 64 << 20
+	// batchSize is the number of messages replayed at once.
+	batchSize = 100
+
+	logFileName    = "spool.log"
+	offsetFileName = "spool.offset"
+)
+
+// ErrFull is returned by Append when the spool reached its size limit.
+var ErrFull = errors.New("spool is full")
+
+// Publisher publishes a single message. It is implemented by kafka.Producer.
+// It must be synchronous, so the message is acknowledged before it is removed from the spool.
+type Publisher interface {
+	Publish(ctx context.Context, msg *kafka.Message) error
+}
+
+// record is a spooled message, stored as a single JSON line.
+type record struct {
+	Topic     string            `json:"topic"`
+	Key       string            `json:"key,omitempty"`
+	Name      string            `json:"name"`
+	Payload   []byte            `json:"payload"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	SpooledAt time.Time         `json:"spooledAt"`
+}
+
+// Spool is an append-only file of the messages which failed to be published.
+// The offset of the first message not yet replayed is kept in a separate file,
+// and the spool is truncated once all messages have been replayed.
+// Once the replayed messages take more than half of the size limit, the messages
+// still waiting are moved to the start of the spool, so it doesn't grow while
+// new messages keep failing.
+//
+// Messages are replayed in the order they were appended. On failure the replay stops
+// and is retried from the failed message with an exponential backoff.
+// Delivery is at least once: a message can be published again if the offset
+// can't be saved after it was published.
+type Spool struct {
+	log       *zap.Logger
+	publisher Publisher
+	dir       string
+	maxBytes  int64
+	interval  time.Duration
+	backoff   backoff.BackOff
+	now       func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	offset int64
+	depth  int64
+}
+
+// Open opens the spool in the given directory, creating it if needed.
+// Zero max bytes and interval are replaced with the defaults.
+func Open(log *zap.Logger, publisher Publisher, dir string, maxBytes int64, interval time.Duration) (*Spool, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	b := backoff.NewExponentialBackOff()
+	// Keep retrying for as long as the broker is unavailable.
+	b.MaxElapsedTime = 0
+
+	s := &Spool{
+		log:       log,
+		publisher: publisher,
+		dir:       dir,
+		maxBytes:  maxBytes,
+		interval:  interval,
+		backoff:   b,
+		now:       time.Now,
+		file:      file,
+	}
+
+	if err := s.load(); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close closes the spool file.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// Append writes the message to the end of the spool. It implements kafka.Spool.
+// The message is synced to the disk before Append returns.
+func (s *Spool) Append(msg *kafka.Message, cause error) error {
+	rec := record{
+		Topic:     msg.Topic,
+		Key:       msg.PartitionKey,
+		Name:      msg.Name,
+		Payload:   msg.Payload,
+		Headers:   msg.Headers,
+		SpooledAt: s.now(),
+	}
+
+	if cause != nil {
+		rec.Error = cause.Error()
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only the messages waiting to be replayed count against the limit.
+	if s.size-s.offset+int64(len(line)) > s.maxBytes {
+		return ErrFull
+	}
+
+	if _, err := s.file.WriteAt(line, s.size); err != nil {
+		return err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.size += int64(len(line))
+	s.depth++
+
+	return nil
+}
+
+// Depth returns the number of messages waiting to be replayed.
+func (s *Spool) Depth() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.depth
+}
+
+// Run replays the spool until the context is done.
+func (s *Spool) Run(ctx context.Context) {
+	s.log.Info("starting spool replay", zap.String("dir", s.dir), zap.Duration("interval", s.interval))
+
+	for {
+		delay := s.interval
+
+		n, err := s.Flush(ctx)
+		switch {
+		case err != nil:
+			delay = s.backoff.NextBackOff()
+
+			s.log.Error("error replaying spooled messages", zap.Error(err), zap.Duration("retryIn", delay))
+		case n == batchSize:
+			// Full batch was replayed, there are probably more messages waiting.
+			s.backoff.Reset()
+			delay = 0
+		default:
+			s.backoff.Reset()
+		}
+
+		select {
+		case <-ctx.Done():
+			s.log.Info("stopping spool replay")
+
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Flush replays a single batch of spooled messages and compacts the spool.
+// It returns the number of replayed messages and stops at the first failure.
+func (s *Spool) Flush(ctx context.Context) (int, error) {
+	n, err := s.replay(ctx)
+
+	if cerr := s.compact(); cerr != nil && err == nil {
+		err = cerr
+	}
+
+	return n, err
+}
+
+// replay publishes a single batch of spooled messages.
+func (s *Spool) replay(ctx context.Context) (int, error) {
+	recs, ends, err := s.read(batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, rec := range recs {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+
+		// Corrupted records can't be replayed, they are skipped.
+		if rec != nil {
+			if err := s.publisher.Publish(rec.context(ctx), rec.message()); err != nil {
+				return i, err
+			}
+		}
+
+		if err := s.commit(ends[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(recs), nil
+}
+
+// load reads the saved offset and counts the messages waiting to be replayed.
+// A partially written last line, left by a crash during Append, is truncated.
+func (s *Spool) load() error {
+	data, err := io.ReadAll(s.file)
+	if err != nil {
+		return err
+	}
+
+	size := int64(bytes.LastIndexByte(data, '\n') + 1)
+	if size != int64(len(data)) {
+		if err := s.file.Truncate(size); err != nil {
+			return err
+		}
+	}
+
+	offset, err := s.readOffset()
+	if err != nil {
+		return err
+	}
+
+	if offset > size {
+		return fmt.Errorf("spool offset %d is beyond the end of the spool (%d bytes)", offset, size)
+	}
+
+	s.size = size
+	s.offset = offset
+	s.depth = int64(bytes.Count(data[offset:size], []byte{'\n'}))
+
+	return nil
+}
+
+// read returns up to limit records following the current offset, together with
+// the offset after each of them. Records which can't be decoded are returned as nil.
+func (s *Spool) read(limit int) ([]*record, []int64, error) {
+	s.mu.Lock()
+	offset, size := s.offset, s.size
+	s.mu.Unlock()
+
+	var (
+		recs []*record
+		ends []int64
+	)
+
+	reader := bufio.NewReader(io.NewSectionReader(s.file, offset, size-offset))
+	for len(recs) < limit {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		offset += int64(len(line))
+
+		rec := &record{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			s.log.Error("skipping corrupted spool record", zap.Int64("offset", offset-int64(len(line))), zap.Error(err))
+
+			rec = nil
+		}
+
+		recs = append(recs, rec)
+		ends = append(ends, offset)
+	}
+
+	return recs, ends, nil
+}
+
+// commit saves the offset of the next message to replay.
+// Once all messages have been replayed the spool is truncated.
+func (s *Spool) commit(offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Offset is reset before truncating the spool, so a crash in between
+	// replays the messages again instead of losing the offset.
+	truncate := offset == s.size
+	if truncate {
+		offset = 0
+	}
+
+	if err := s.writeOffset(offset); err != nil {
+		return err
+	}
+
+	if truncate {
+		if err := s.file.Truncate(0); err != nil {
+			return err
+		}
+
+		s.size = 0
+	}
+
+	s.offset = offset
+	s.depth--
+
+	return nil
+}
+
+// compact moves the messages waiting to be replayed to the start of the spool
+// once the replayed messages take more than half of the size limit.
+// It must not run concurrently with replay, since it replaces the spool file.
+func (s *Spool) compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.offset <= s.maxBytes/2 {
+		return nil
+	}
+
+	path := filepath.Join(s.dir, logFileName)
+
+	tmp, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err := s.copyPending(tmp); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	// Offset is reset before replacing the spool, so a crash in between
+	// replays the messages again instead of losing the offset.
+	if err := s.writeOffset(0); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	s.file.Close()
+
+	s.file = tmp
+	s.size -= s.offset
+	s.offset = 0
+
+	return nil
+}
+
+// copyPending copies the messages waiting to be replayed to the file and syncs it.
+func (s *Spool) copyPending(file *os.File) error {
+	if _, err := io.Copy(file, io.NewSectionReader(s.file, s.offset, s.size-s.offset)); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+func (s *Spool) readOffset() (int64, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, offsetFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(string(bytes.TrimSpace(data)), 10, 64)
+}
+
+// writeOffset replaces the offset file, so a crash never leaves a partially written offset.
+func (s *Spool) writeOffset(offset int64) error {
+	path := filepath.Join(s.dir, offsetFileName)
+
+	if err := os.WriteFile(path+".tmp", []byte(strconv.FormatInt(offset, 10)), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// context returns the context with the correlation id the message was originally sent with.
+func (r *record) context(ctx context.Context) context.Context {
+	if cid := r.Headers[kafka.CIDHeader]; cid != "" {
+		return ccid.WithContext(ctx, cid)
+	}
+
+	return ctx
+}
+
+// message converts the record to the message sent by the producer.
+func (r *record) message() *kafka.Message {
+	return &kafka.Message{
+		Topic:        r.Topic,
+		PartitionKey: r.Key,
+		Name:         r.Name,
+		Payload:      r.Payload,
+		Headers:      r.Headers,
+	}
+}
@@ -0,0 +1,220 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	ccid "github.com/kperanovic/epam-systems/internal/cid"
+	"github.com/kperanovic/epam-systems/internal/kafka"
+	"github.com/kperanovic/epam-systems/internal/logger"
+)
+
+// fakePublisher records the published messages and fails once failAfter messages were published.
+type fakePublisher struct {
+	published []*kafka.Message
+	cids      []string
+	failAfter int
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, msg *kafka.Message) error {
+	if p.failAfter >= 0 && len(p.published) == p.failAfter {
+		return errors.New("broker unavailable")
+	}
+
+	p.published = append(p.published, msg)
+	p.cids = append(p.cids, ccid.FromContext(ctx))
+
+	return nil
+}
+
+func testMessage(name string) *kafka.Message {
+	return &kafka.Message{
+		Topic:        "company.created",
+		PartitionKey: "company-id",
+		Name:         name,
+		Payload:      []byte("payload"),
+		Headers: map[string]string{
+			kafka.MessageNameHeader: name,
+			kafka.CIDHeader:         "test-cid",
+		},
+	}
+}
+
+func TestSpool_Flush(t *testing.T) {
+	dir := t.TempDir()
+	publisher := &fakePublisher{failAfter: 1}
+
+	s, err := Open(logger.NewDevelopment(), publisher, dir, 0, 0)
+	assert.Equal(t, err, nil)
+
+	for _, name := range []string{"COMPANY_CREATED", "COMPANY_UPDATED", "COMPANY_DELETED"} {
+		err = s.Append(testMessage(name), errors.New("broker unavailable"))
+		assert.Equal(t, err, nil)
+	}
+	assert.Equal(t, s.Depth(), int64(3))
+
+	// Replay stops at the first failure
+	n, err := s.Flush(context.Background())
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, n, 1)
+	assert.Equal(t, s.Depth(), int64(2))
+
+	// Spool survives a restart
+	assert.Equal(t, s.Close(), nil)
+
+	s, err = Open(logger.NewDevelopment(), publisher, dir, 0, 0)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, s.Depth(), int64(2))
+
+	// Remaining messages are replayed in order, with their headers and correlation id
+	publisher.failAfter = -1
+
+	n, err = s.Flush(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 2)
+	assert.Equal(t, s.Depth(), int64(0))
+
+	assert.Equal(t, len(publisher.published), 3)
+	assert.Equal(t, publisher.published[2], testMessage("COMPANY_DELETED"))
+	assert.Equal(t, publisher.cids, []string{"test-cid", "test-cid", "test-cid"})
+
+	// Replayed spool is truncated
+	info, err := os.Stat(filepath.Join(dir, logFileName))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, info.Size(), int64(0))
+
+	assert.Equal(t, s.Close(), nil)
+}
+
+func TestSpool_Append_Full(t *testing.T) {
+	s, err := Open(logger.NewDevelopment(), &fakePublisher{failAfter: -1}, t.TempDir(), 300, 0)
+	assert.Equal(t, err, nil)
+
+	err = s.Append(testMessage("COMPANY_CREATED"), nil)
+	assert.Equal(t, err, nil)
+
+	err = s.Append(testMessage("COMPANY_CREATED"), nil)
+	assert.Equal(t, err, ErrFull)
+	assert.Equal(t, s.Depth(), int64(1))
+
+	// Replaying the spool frees the space
+	_, err = s.Flush(context.Background())
+	assert.Equal(t, err, nil)
+
+	err = s.Append(testMessage("COMPANY_CREATED"), nil)
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, s.Close(), nil)
+}
+
+func TestSpool_Compact(t *testing.T) {
+	dir := t.TempDir()
+	publisher := &fakePublisher{failAfter: -1}
+
+	// Messages of the same size, numbered in the order they are appended
+	message := func(i int) *kafka.Message {
+		msg := testMessage("COMPANY_UPDATED")
+		msg.PartitionKey = fmt.Sprintf("company-%d", i)
+
+		return msg
+	}
+
+	// Records are spooled at the same time, so they have the same size as well
+	spooledAt := time.Now()
+	now := func() time.Time { return spooledAt }
+
+	s, err := Open(logger.NewDevelopment(), publisher, dir, 1<<20, 0)
+	assert.Equal(t, err, nil)
+
+	s.now = now
+	assert.Equal(t, s.Append(message(0), nil), nil)
+
+	recordSize := s.size
+	assert.Equal(t, s.Close(), nil)
+
+	// Spool fits four messages
+	dir = t.TempDir()
+
+	s, err = Open(logger.NewDevelopment(), publisher, dir, 4*recordSize, 0)
+	assert.Equal(t, err, nil)
+
+	s.now = now
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, s.Append(message(i), nil), nil)
+	}
+	assert.Equal(t, s.Append(message(4), nil), ErrFull)
+
+	// Replaying three of them moves the last one to the start of the spool
+	publisher.failAfter = 3
+
+	n, err := s.Flush(context.Background())
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, n, 3)
+	assert.Equal(t, s.Depth(), int64(1))
+
+	info, err := os.Stat(filepath.Join(dir, logFileName))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, info.Size(), recordSize)
+
+	// Space of the replayed messages can be used again
+	for i := 4; i < 7; i++ {
+		assert.Equal(t, s.Append(message(i), nil), nil)
+	}
+	assert.Equal(t, s.Append(message(7), nil), ErrFull)
+
+	// Compacted spool survives a restart and is replayed in order
+	assert.Equal(t, s.Close(), nil)
+
+	s, err = Open(logger.NewDevelopment(), publisher, dir, 4*recordSize, 0)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, s.Depth(), int64(4))
+
+	publisher.failAfter = -1
+
+	n, err = s.Flush(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 4)
+
+	for i, msg := range publisher.published {
+		assert.Equal(t, msg, message(i))
+	}
+
+	assert.Equal(t, s.Close(), nil)
+}
+
+func TestSpool_Open_PartialRecord(t *testing.T) {
+	dir := t.TempDir()
+	publisher := &fakePublisher{failAfter: -1}
+
+	s, err := Open(logger.NewDevelopment(), publisher, dir, 0, 0)
+	assert.Equal(t, err, nil)
+
+	err = s.Append(testMessage("COMPANY_CREATED"), nil)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, s.Close(), nil)
+
+	// Simulate a crash in the middle of writing a record
+	f, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.Equal(t, err, nil)
+	_, err = f.WriteString(`{"topic":"company.cr`)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, f.Close(), nil)
+
+	s, err = Open(logger.NewDevelopment(), publisher, dir, 0, 0)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, s.Depth(), int64(1))
+
+	n, err := s.Flush(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 1)
+	assert.Equal(t, publisher.published[0].Name, "COMPANY_CREATED")
+
+	assert.Equal(t, s.Close(), nil)
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+)
+
+// DefaultCompanyTypes are the company types every storage is seeded with.
+var DefaultCompanyTypes = []types.CompanyType{
+	{ID: 1, Name: "Corporations"},
+	{ID: 2, Name: "NonProfit"},
+	{ID: 3, Name: "Cooperative"},
+	{ID: 4, Name: "Sole Proprietorship"},
+}
+
+// validateCompany checks the rules every stored company has to satisfy.
+// typeExists reports whether the referenced company type is known to the storage.
+func validateCompany(company *types.Company, typeExists func(id int) (bool, error)) error {
+	if company.ID == uuid.Nil {
+		return &FieldError{Field: "uuid", Message: "is required"}
+	}
+
+	if company.Employees < 0 {
+		return &FieldError{Field: "employees", Message: "must not be negative"}
+	}
+
+	ok, err := typeExists(company.CompanyType)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return &FieldError{Field: "companyType", Message: "must reference an existing company type"}
+	}
+
+	return nil
+}
+
+// checkVersion compares the stored version of the company with the expected one.
+func checkVersion(company *types.Company, version int) error {
+	if version != AnyVersion && company.Version != version {
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// unchanged reports whether the update left the company as it was.
+// Version is ignored, since an update function can replace the whole company.
+func unchanged(before, after *types.Company) bool {
+	updated := *after
+	updated.Version = before.Version
+
+	return updated == *before
+}
+
+// applyUpdate runs the update function on the company and validates the result.
+// Company id can't be changed by the update.
+func applyUpdate(id uuid.UUID, company *types.Company, update UpdateFunc, typeExists func(id int) (bool, error)) error {
+	if err := update(company); err != nil {
+		return err
+	}
+
+	if company.ID != id {
+		return &FieldError{Field: "uuid", Message: "can't be changed"}
+	}
+
+	return validateCompany(company, typeExists)
+}
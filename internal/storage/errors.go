@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by every Storage implementation.
+// Backend specific errors are translated to one of these,
+// so callers can check them with errors.Is() regardless of the backend in use.
+var (
+	// ErrNotFound is returned when the requested record doesn't exist.
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict is returned when the record clashes with an existing one.
+	ErrConflict = errors.New("record already exists")
+	// ErrValidation is returned when the input can't be accepted by the storage.
+	ErrValidation = errors.New("validation failed")
+	// ErrVersionMismatch is returned when the record was changed since the expected version.
+	ErrVersionMismatch = errors.New("record version mismatch")
+)
+
+// FieldError is a validation error caused by a single field of the record.
+// It matches ErrValidation when checked with errors.Is().
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s %s", ErrValidation, e.Field, e.Message)
+}
+
+func (e *FieldError) Unwrap() error {
+	return ErrValidation
+}
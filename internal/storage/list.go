@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+)
+
+const (
+	// DefaultListLimit is the page size used when ListOptions.Limit is not set.
+	DefaultListLimit = 20
+	// MaxListLimit is the biggest page size a client can ask for.
+	MaxListLimit = 100
+)
+
+// Supported sort keys. Prefixing a key with "-" sorts in descending order.
+const (
+	SortByName      = "name"
+	SortByEmployees = "employees"
+)
+
+// ErrInvalidCursor is returned when the pagination cursor can't be decoded
+// or was created for a different ordering. It wraps ErrValidation.
+var ErrInvalidCursor = fmt.Errorf("%w: invalid cursor", ErrValidation)
+
+// ListOptions holds the filters, sorting and pagination
+// parameters used by Storage.ListCompanies().
+// Nil filters are ignored.
+type ListOptions struct {
+	// Name matches companies whose name contains the given value.
+	Name         string
+	CompanyType  *int
+	Registered   *bool
+	MinEmployees *int
+	MaxEmployees *int
+	// Sort is one of the Sort* keys, optionally prefixed with "-".
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// cursor is the decoded representation of the opaque pagination cursor.
+// It holds the sort key and the sort value of the last returned company,
+// so the next page can continue right after it.
+type cursor struct {
+	Sort      string    `json:"s"`
+	Name      string    `json:"n,omitempty"`
+	Employees int       `json:"e,omitempty"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// sortSpec describes how the results are ordered.
+// Ties are always broken by the company ID.
+type sortSpec struct {
+	key    string
+	column string
+	desc   bool
+}
+
+// parseSort converts the sort option into a sortSpec.
+// Empty value sorts by name in ascending order.
+func parseSort(sort string) (sortSpec, error) {
+	if sort == "" {
+		sort = SortByName
+	}
+
+	spec := sortSpec{key: sort}
+	if strings.HasPrefix(sort, "-") {
+		spec.desc = true
+		sort = strings.TrimPrefix(sort, "-")
+	}
+
+	switch sort {
+	case SortByName, SortByEmployees:
+		spec.column = sort
+	default:
+		return sortSpec{}, fmt.Errorf("%w: unsupported sort key %q", ErrValidation, spec.key)
+	}
+
+	return spec, nil
+}
+
+// normalize validates the options and fills in the defaults.
+func (o *ListOptions) normalize() (sortSpec, *cursor, error) {
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+
+	spec, err := parseSort(o.Sort)
+	if err != nil {
+		return sortSpec{}, nil, err
+	}
+
+	if o.Cursor == "" {
+		return spec, nil, nil
+	}
+
+	c, err := decodeCursor(o.Cursor)
+	if err != nil {
+		return sortSpec{}, nil, err
+	}
+
+	// Cursor is only valid for the ordering it was created with.
+	if c.Sort != spec.key {
+		return sortSpec{}, nil, ErrInvalidCursor
+	}
+
+	return spec, c, nil
+}
+
+// newCursor creates an opaque cursor pointing after the given company.
+func newCursor(spec sortSpec, company *types.Company) string {
+	c := cursor{
+		Sort: spec.key,
+		ID:   company.ID,
+	}
+
+	switch spec.column {
+	case SortByName:
+		c.Name = company.Name
+	case SortByEmployees:
+		c.Employees = company.Employees
+	}
+
+	buf, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decodeCursor decodes the opaque cursor sent by the client.
+func decodeCursor(s string) (*cursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
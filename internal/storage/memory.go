@@ -1,17 +1,46 @@
 package storage
 
 import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/kperanovic/epam-systems/api/v1/types"
 )
 
+// memoryStorage keeps companies in a map. Companies are copied on the way
+// in and out of the store, so callers can't modify the stored records
+// without going through UpdateCompany().
 type memoryStorage struct {
-	store map[uuid.UUID]*types.Company
+	mu           sync.RWMutex
+	store        map[uuid.UUID]*types.Company
+	companyTypes map[int]types.CompanyType
+
+	// outbox holds the undelivered messages and is guarded by the same lock
+	// as the companies, so a change and its event are stored atomically.
+	outbox    []*OutboxMessage
+	outboxSeq uint64
+
+	revokedTokens map[uuid.UUID]*RevokedToken
+	revokedUsers  map[uuid.UUID]*RevokedUser
+	refreshTokens map[string]*RefreshToken
 }
 
 func NewMemoryStorage() *memoryStorage {
+	companyTypes := make(map[int]types.CompanyType, len(DefaultCompanyTypes))
+	for _, ct := range DefaultCompanyTypes {
+		companyTypes[ct.ID] = ct
+	}
+
 	return &memoryStorage{
-		store: make(map[uuid.UUID]*types.Company, 0),
+		store:         make(map[uuid.UUID]*types.Company, 0),
+		companyTypes:  companyTypes,
+		revokedTokens: make(map[uuid.UUID]*RevokedToken),
+		revokedUsers:  make(map[uuid.UUID]*RevokedUser),
+		refreshTokens: make(map[string]*RefreshToken),
 	}
 }
 
@@ -19,24 +48,481 @@ func (mem *memoryStorage) Connect() error {
 	return nil
 }
 
-func (mem *memoryStorage) SaveCompany(company *types.Company) error {
-	mem.store[company.ID] = company
+func (mem *memoryStorage) SaveCompany(ctx context.Context, company *types.Company, event EventFunc) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	if err := validateCompany(company, mem.companyTypeExists); err != nil {
+		return err
+	}
+
+	if _, ok := mem.store[company.ID]; ok {
+		return ErrConflict
+	}
+
+	company.Version = 1
+	stored := *company
+
+	created := stored
+	msg, err := buildEvent(event, nil, &created)
+	if err != nil {
+		return err
+	}
+
+	mem.store[company.ID] = &stored
+	mem.appendOutbox(msg)
 
 	return nil
 }
 
-func (mem *memoryStorage) GetCompany(id uuid.UUID) (*types.Company, error) {
-	return mem.store[id], nil
+func (mem *memoryStorage) GetCompany(ctx context.Context, id uuid.UUID) (*types.Company, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	company, ok := mem.store[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	found := *company
+
+	return &found, nil
 }
 
-func (mem *memoryStorage) UpdateCompany(id uuid.UUID, company *types.Company) error {
-	mem.store[id] = company
+func (mem *memoryStorage) ListCompanies(ctx context.Context, opts ListOptions) ([]*types.Company, string, error) {
+	spec, after, err := opts.normalize()
+	if err != nil {
+		return nil, "", err
+	}
+
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
 
-	return nil
+	var companies []*types.Company
+	for _, company := range mem.store {
+		if matches(company, opts) {
+			found := *company
+			companies = append(companies, &found)
+		}
+	}
+
+	sort.Slice(companies, func(i, j int) bool {
+		return less(spec, companies[i], companies[j])
+	})
+
+	// Skip everything up to and including the company the cursor points to.
+	if after != nil {
+		pos := sort.Search(len(companies), func(i int) bool {
+			return spec.afterCursor(companies[i], after)
+		})
+		companies = companies[pos:]
+	}
+
+	if len(companies) <= opts.Limit {
+		return companies, "", nil
+	}
+
+	companies = companies[:opts.Limit]
+
+	return companies, newCursor(spec, companies[len(companies)-1]), nil
 }
 
-func (mem *memoryStorage) DeleteCompany(id uuid.UUID) error {
+func (mem *memoryStorage) UpdateCompany(ctx context.Context, id uuid.UUID, version int, update UpdateFunc, event EventFunc) (*types.Company, *types.Company, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	current, ok := mem.store[id]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+
+	// Compare and swap is done while holding the lock,
+	// so the version can't change between the check and the write.
+	if err := checkVersion(current, version); err != nil {
+		return nil, nil, err
+	}
+
+	// Update works on a copy, so a failed update leaves the stored record untouched.
+	company := *current
+	if err := applyUpdate(id, &company, update, mem.companyTypeExists); err != nil {
+		return nil, nil, err
+	}
+
+	before := *current
+
+	// Nothing changed, so there is nothing to save or publish.
+	if unchanged(&before, &company) {
+		after := before
+
+		return &before, &after, nil
+	}
+
+	company.Version = current.Version + 1
+
+	after := company
+	msg, err := buildEvent(event, &before, &after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mem.store[id] = &company
+	mem.appendOutbox(msg)
+
+	updated := company
+
+	return &before, &updated, nil
+}
+
+func (mem *memoryStorage) DeleteCompany(ctx context.Context, id uuid.UUID, version int, event EventFunc) (*types.Company, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	current, ok := mem.store[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if err := checkVersion(current, version); err != nil {
+		return nil, err
+	}
+
+	deleted := *current
+	msg, err := buildEvent(event, &deleted, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	delete(mem.store, id)
+	mem.appendOutbox(msg)
+
+	result := deleted
+
+	return &result, nil
+}
+
+func (mem *memoryStorage) PendingMessages(limit int) ([]*OutboxMessage, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	var pending []*OutboxMessage
+	for _, msg := range mem.outbox {
+		if len(pending) == limit {
+			break
+		}
+
+		found := *msg
+		pending = append(pending, &found)
+	}
+
+	return pending, nil
+}
+
+// MarkDelivered removes the message from the outbox,
+// since there is no need to keep the history in memory.
+func (mem *memoryStorage) MarkDelivered(id uint64) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	for i, msg := range mem.outbox {
+		if msg.ID == id {
+			mem.outbox = append(mem.outbox[:i], mem.outbox[i+1:]...)
+
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (mem *memoryStorage) MarkFailed(id uint64, cause error) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	msg := mem.findOutbox(id)
+	if msg == nil {
+		return ErrNotFound
+	}
+
+	msg.Attempts++
+	msg.LastError = truncateError(cause)
+
+	return nil
+}
+
+func (mem *memoryStorage) OutboxStats() (OutboxStats, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	var stats OutboxStats
+	if len(mem.outbox) > 0 {
+		stats.Pending = int64(len(mem.outbox))
+		stats.OldestCreatedAt = mem.outbox[0].CreatedAt
+	}
+
+	return stats, nil
+}
+
+func (mem *memoryStorage) RevokeToken(ctx context.Context, token *RevokedToken) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	if _, ok := mem.revokedTokens[token.TokenID]; ok {
+		return nil
+	}
+
+	stored := *token
+	stored.CreatedAt = time.Now()
+	mem.revokedTokens[token.TokenID] = &stored
+
+	return nil
+}
+
+func (mem *memoryStorage) RevokeUser(ctx context.Context, user *RevokedUser) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	stored := *user
+	if existing, ok := mem.revokedUsers[user.UserID]; ok {
+		stored.RevokedBefore = later(existing.RevokedBefore, user.RevokedBefore)
+		stored.ExpiresAt = later(existing.ExpiresAt, user.ExpiresAt)
+	}
+
+	mem.revokedUsers[user.UserID] = &stored
+
+	return nil
+}
+
+func (mem *memoryStorage) IsRevoked(ctx context.Context, tokenID, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	if _, ok := mem.revokedTokens[tokenID]; ok {
+		return true, nil
+	}
+
+	user, ok := mem.revokedUsers[userID]
+
+	return ok && issuedAt.Before(user.RevokedBefore), nil
+}
+
+func (mem *memoryStorage) PruneRevocations(ctx context.Context, now time.Time) (int64, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	var pruned int64
+
+	for id, token := range mem.revokedTokens {
+		if token.ExpiresAt.Before(now) {
+			delete(mem.revokedTokens, id)
+			pruned++
+		}
+	}
+
+	for id, user := range mem.revokedUsers {
+		if user.ExpiresAt.Before(now) {
+			delete(mem.revokedUsers, id)
+			pruned++
+		}
+	}
+
+	return pruned, nil
+}
+
+func (mem *memoryStorage) SaveRefreshToken(ctx context.Context, token *RefreshToken) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	if _, ok := mem.refreshTokens[token.Hash]; ok {
+		return ErrConflict
+	}
+
+	token.CreatedAt = time.Now()
+	stored := *token
+	mem.refreshTokens[token.Hash] = &stored
+
+	return nil
+}
+
+func (mem *memoryStorage) GetRefreshToken(ctx context.Context, hash string) (*RefreshToken, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	token, ok := mem.refreshTokens[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	found := *token
+
+	return &found, nil
+}
+
+func (mem *memoryStorage) RotateRefreshToken(ctx context.Context, hash string, usedAt time.Time, next *RefreshToken) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	token, ok := mem.refreshTokens[hash]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if token.UsedAt != nil || token.RevokedAt != nil {
+		return ErrConflict
+	}
+
+	if _, ok := mem.refreshTokens[next.Hash]; ok {
+		return ErrConflict
+	}
+
+	token.UsedAt = &usedAt
+
+	next.CreatedAt = time.Now()
+	stored := *next
+	mem.refreshTokens[next.Hash] = &stored
+
+	return nil
+}
+
+func (mem *memoryStorage) RevokeRefreshFamily(ctx context.Context, familyID uuid.UUID, revokedAt time.Time) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.revokeRefreshTokens(func(token *RefreshToken) bool { return token.FamilyID == familyID }, revokedAt)
+
+	return nil
+}
+
+func (mem *memoryStorage) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID, revokedAt time.Time) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.revokeRefreshTokens(func(token *RefreshToken) bool { return token.UserID == userID }, revokedAt)
 
 	return nil
 }
+
+func (mem *memoryStorage) PruneRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	var pruned int64
+
+	for hash, token := range mem.refreshTokens {
+		if token.ExpiresAt.Before(now) {
+			delete(mem.refreshTokens, hash)
+			pruned++
+		}
+	}
+
+	return pruned, nil
+}
+
+// revokeRefreshTokens revokes the matching refresh tokens which aren't revoked yet.
+// Caller must hold the write lock.
+func (mem *memoryStorage) revokeRefreshTokens(match func(token *RefreshToken) bool, revokedAt time.Time) {
+	for _, token := range mem.refreshTokens {
+		if token.RevokedAt == nil && match(token) {
+			revoked := revokedAt
+			token.RevokedAt = &revoked
+		}
+	}
+}
+
+// appendOutbox adds the message to the outbox. Nil messages are ignored.
+// Caller must hold the write lock.
+func (mem *memoryStorage) appendOutbox(msg *OutboxMessage) {
+	if msg == nil {
+		return
+	}
+
+	mem.outboxSeq++
+	msg.ID = mem.outboxSeq
+	msg.CreatedAt = time.Now()
+
+	mem.outbox = append(mem.outbox, msg)
+}
+
+// findOutbox returns the pending outbox message with the given id or nil.
+// Caller must hold the lock.
+func (mem *memoryStorage) findOutbox(id uint64) *OutboxMessage {
+	for _, msg := range mem.outbox {
+		if msg.ID == id {
+			return msg
+		}
+	}
+
+	return nil
+}
+
+// companyTypeExists checks if the company type is known to the storage.
+func (mem *memoryStorage) companyTypeExists(id int) (bool, error) {
+	_, ok := mem.companyTypes[id]
+
+	return ok, nil
+}
+
+// matches checks if the company satisfies all filters set in the options.
+func matches(company *types.Company, opts ListOptions) bool {
+	if opts.Name != "" && !strings.Contains(strings.ToLower(company.Name), strings.ToLower(opts.Name)) {
+		return false
+	}
+
+	if opts.CompanyType != nil && company.CompanyType != *opts.CompanyType {
+		return false
+	}
+
+	if opts.Registered != nil && company.Registered != *opts.Registered {
+		return false
+	}
+
+	if opts.MinEmployees != nil && company.Employees < *opts.MinEmployees {
+		return false
+	}
+
+	if opts.MaxEmployees != nil && company.Employees > *opts.MaxEmployees {
+		return false
+	}
+
+	return true
+}
+
+// less reports whether company a is ordered before company b.
+func less(spec sortSpec, a, b *types.Company) bool {
+	cmp := compare(spec, a, b.Name, b.Employees, b.ID)
+	if spec.desc {
+		return cmp > 0
+	}
+
+	return cmp < 0
+}
+
+// afterCursor reports whether the company is ordered after the cursor position.
+func (spec sortSpec) afterCursor(company *types.Company, c *cursor) bool {
+	cmp := compare(spec, company, c.Name, c.Employees, c.ID)
+	if spec.desc {
+		return cmp < 0
+	}
+
+	return cmp > 0
+}
+
+// compare compares the company with the given sort values,
+// falling back to the ID when the sort values are equal.
+// Names are compared case-insensitively, like the MySQL collation does.
+func compare(spec sortSpec, company *types.Company, name string, employees int, id uuid.UUID) int {
+	switch spec.column {
+	case SortByName:
+		if cmp := strings.Compare(strings.ToLower(company.Name), strings.ToLower(name)); cmp != 0 {
+			return cmp
+		}
+	case SortByEmployees:
+		if company.Employees != employees {
+			if company.Employees < employees {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(company.ID.String(), id.String())
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
 
@@ -15,10 +17,20 @@ func generateCompany(uid uuid.UUID) *types.Company {
 		Description: "desc",
 		Employees:   10,
 		Registered:  true,
+		CompanyType: 1,
 	}
 
 }
 
+// savedCompany returns the company generated by generateCompany()
+// in the state it is returned from storage after it was saved.
+func savedCompany(uid uuid.UUID) *types.Company {
+	company := generateCompany(uid)
+	company.Version = 1
+
+	return company
+}
+
 func TestNewMemoryStorage(t *testing.T) {
 	tests := []struct {
 		name string
@@ -28,6 +40,15 @@ func TestNewMemoryStorage(t *testing.T) {
 			name: "Test NewMemoryStorage()",
 			want: &memoryStorage{
 				store: make(map[uuid.UUID]*types.Company),
+				companyTypes: map[int]types.CompanyType{
+					1: {ID: 1, Name: "Corporations"},
+					2: {ID: 2, Name: "NonProfit"},
+					3: {ID: 3, Name: "Cooperative"},
+					4: {ID: 4, Name: "Sole Proprietorship"},
+				},
+				revokedTokens: make(map[uuid.UUID]*RevokedToken),
+				revokedUsers:  make(map[uuid.UUID]*RevokedUser),
+				refreshTokens: make(map[string]*RefreshToken),
 			},
 		},
 	}
@@ -73,9 +94,7 @@ func Test_memoryStorage_SaveCompany(t *testing.T) {
 	}{
 		{
 			name: "Test memory storage SaveCompany()",
-			m: &memoryStorage{
-				store: make(map[uuid.UUID]*types.Company),
-			},
+			m:    NewMemoryStorage(),
 			args: args{
 				company: generateCompany(uuid.New()),
 			},
@@ -83,7 +102,7 @@ func Test_memoryStorage_SaveCompany(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.m.SaveCompany(tt.args.company); (err != nil) != tt.wantErr {
+			if err := tt.m.SaveCompany(context.Background(), tt.args.company, nil); (err != nil) != tt.wantErr {
 				t.Errorf("memoryStorage.SaveCompany() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -109,21 +128,19 @@ func Test_memoryStorage_GetCompany(t *testing.T) {
 	}{
 		{
 			name: "Test memory storage GetCompany()",
-			m: &memoryStorage{
-				store: make(map[uuid.UUID]*types.Company),
-			},
+			m:    NewMemoryStorage(),
 			args: args{
 				id: uid,
 			},
-			want:    generateCompany(uid),
+			want:    savedCompany(uid),
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.m.SaveCompany(generateCompany(tt.args.id))
+			tt.m.SaveCompany(context.Background(), generateCompany(tt.args.id), nil)
 
-			got, err := tt.m.GetCompany(tt.args.id)
+			got, err := tt.m.GetCompany(context.Background(), tt.args.id)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("memoryStorage.GetCompany() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -143,45 +160,124 @@ func Test_memoryStorage_UpdateCompany(t *testing.T) {
 		return
 	}
 
-	update := generateCompany(uid)
-	update.Employees = 500
+	expected := generateCompany(uid)
+	expected.Employees = 500
+	expected.Version = 2
+
+	unchanged := savedCompany(uid)
+
+	zero := generateCompany(uid)
+	zero.Employees = 0
+	zero.Registered = false
+	zero.Version = 2
 
 	type args struct {
 		id      uuid.UUID
-		company *types.Company
+		version int
+		update  UpdateFunc
 	}
 	tests := []struct {
 		name    string
 		m       *memoryStorage
 		args    args
+		want    *types.Company
 		wantErr bool
 	}{
 		{
 			name: "Test memory storage UpdateCompany()",
-			m: &memoryStorage{
-				store: make(map[uuid.UUID]*types.Company),
+			m:    NewMemoryStorage(),
+			args: args{
+				id:      uid,
+				version: 1,
+				update: func(company *types.Company) error {
+					company.Employees = 500
+					return nil
+				},
+			},
+			want:    expected,
+			wantErr: false,
+		},
+		{
+			name: "Test memory storage UpdateCompany() zero values",
+			m:    NewMemoryStorage(),
+			args: args{
+				id:      uid,
+				version: 1,
+				update: func(company *types.Company) error {
+					company.Employees = 0
+					company.Registered = false
+					return nil
+				},
 			},
+			want:    zero,
+			wantErr: false,
+		},
+		{
+			name: "Test memory storage UpdateCompany() with any version",
+			m:    NewMemoryStorage(),
 			args: args{
 				id:      uid,
-				company: update,
+				version: AnyVersion,
+				update: func(company *types.Company) error {
+					company.Employees = 500
+					return nil
+				},
 			},
+			want:    expected,
 			wantErr: false,
 		},
+		{
+			name: "Test memory storage UpdateCompany() with stale version",
+			m:    NewMemoryStorage(),
+			args: args{
+				id:      uid,
+				version: 2,
+				update: func(company *types.Company) error {
+					company.Employees = 500
+					return nil
+				},
+			},
+			want:    unchanged,
+			wantErr: true,
+		},
+		{
+			name: "Test memory storage UpdateCompany() with failing update",
+			m:    NewMemoryStorage(),
+			args: args{
+				id: uid,
+				update: func(company *types.Company) error {
+					company.Employees = 500
+					return errors.New("update failed")
+				},
+			},
+			want:    unchanged,
+			wantErr: true,
+		},
+		{
+			name: "Test memory storage UpdateCompany() changing the id",
+			m:    NewMemoryStorage(),
+			args: args{
+				id: uid,
+				update: func(company *types.Company) error {
+					company.ID = uuid.New()
+					return nil
+				},
+			},
+			want:    unchanged,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.m.SaveCompany(generateCompany(tt.args.id))
+			tt.m.SaveCompany(context.Background(), generateCompany(tt.args.id), nil)
 
-			if err := tt.m.UpdateCompany(tt.args.id, tt.args.company); (err != nil) != tt.wantErr {
+			if _, _, err := tt.m.UpdateCompany(context.Background(), tt.args.id, tt.args.version, tt.args.update, nil); (err != nil) != tt.wantErr {
 				t.Errorf("memoryStorage.UpdateCompany() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
-			expected := generateCompany(tt.args.id)
-			expected.Employees = 500
-
-			got, err := tt.m.GetCompany(tt.args.id)
-			if (err != nil) && got != expected {
-				t.Errorf("memoryStorage.GetCompany() error = %v, wantErr %v", got, expected)
+			got, err := tt.m.GetCompany(context.Background(), tt.args.id)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("memoryStorage.GetCompany() = %v, want %v", got, tt.want)
 				return
 			}
 		})
@@ -206,9 +302,7 @@ func Test_memoryStorage_DeleteCompany(t *testing.T) {
 	}{
 		{
 			name: "Test memory store DeleteCompany()",
-			m: &memoryStorage{
-				store: make(map[uuid.UUID]*types.Company),
-			},
+			m:    NewMemoryStorage(),
 			args: args{
 				id: uid,
 			},
@@ -217,13 +311,13 @@ func Test_memoryStorage_DeleteCompany(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.m.SaveCompany(generateCompany(tt.args.id))
+			tt.m.SaveCompany(context.Background(), generateCompany(tt.args.id), nil)
 
-			if err := tt.m.DeleteCompany(tt.args.id); (err != nil) != tt.wantErr {
+			if _, err := tt.m.DeleteCompany(context.Background(), tt.args.id, AnyVersion, nil); (err != nil) != tt.wantErr {
 				t.Errorf("memoryStorage.DeleteCompany() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
-			got, err := tt.m.GetCompany(tt.args.id)
+			got, err := tt.m.GetCompany(context.Background(), tt.args.id)
 			if (err != nil) && got != nil {
 				t.Errorf("memoryStorage.GetCompany() error = %v, wantErr %v", got, nil)
 				return
@@ -231,3 +325,263 @@ func Test_memoryStorage_DeleteCompany(t *testing.T) {
 		})
 	}
 }
+
+func Test_memoryStorage_ListCompanies(t *testing.T) {
+	m := NewMemoryStorage()
+
+	names := []string{"delta", "alpha", "charlie", "bravo", "Echo"}
+	for i, name := range names {
+		company := generateCompany(uuid.New())
+		company.Name = name
+		company.Employees = i
+		company.Registered = i%2 == 0
+
+		m.SaveCompany(context.Background(), company, nil)
+	}
+
+	registered := true
+
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "Test memory storage ListCompanies() default sort",
+			opts: ListOptions{},
+			want: []string{"alpha", "bravo", "charlie", "delta", "Echo"},
+		},
+		{
+			name: "Test memory storage ListCompanies() with filters",
+			opts: ListOptions{Registered: &registered, Sort: "-name"},
+			want: []string{"Echo", "delta", "charlie"},
+		},
+		{
+			name: "Test memory storage ListCompanies() with name filter",
+			opts: ListOptions{Name: "LP"},
+			want: []string{"alpha"},
+		},
+		{
+			name: "Test memory storage ListCompanies() with wildcard name filter",
+			opts: ListOptions{Name: "_"},
+		},
+		{
+			name:    "Test memory storage ListCompanies() with invalid sort",
+			opts:    ListOptions{Sort: "description"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := m.ListCompanies(context.Background(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("memoryStorage.ListCompanies() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var gotNames []string
+			for _, company := range got {
+				gotNames = append(gotNames, company.Name)
+			}
+
+			if !reflect.DeepEqual(gotNames, tt.want) {
+				t.Errorf("memoryStorage.ListCompanies() = %v, want %v", gotNames, tt.want)
+			}
+		})
+	}
+}
+
+func Test_memoryStorage_ListCompanies_Pagination(t *testing.T) {
+	m := NewMemoryStorage()
+
+	for i := 0; i < 5; i++ {
+		company := generateCompany(uuid.New())
+		company.Employees = 10
+
+		m.SaveCompany(context.Background(), company, nil)
+	}
+
+	// Walk through all pages and make sure every company is returned exactly once.
+	seen := make(map[uuid.UUID]bool)
+	cursor := ""
+	for {
+		got, next, err := m.ListCompanies(context.Background(), ListOptions{Sort: SortByEmployees, Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Errorf("memoryStorage.ListCompanies() error = %v", err)
+			return
+		}
+
+		for _, company := range got {
+			if seen[company.ID] {
+				t.Errorf("memoryStorage.ListCompanies() returned %s twice", company.ID)
+			}
+			seen[company.ID] = true
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if len(seen) != 5 {
+		t.Errorf("memoryStorage.ListCompanies() returned %d companies, want %d", len(seen), 5)
+	}
+
+	// Cursor created for one ordering can't be used with another.
+	_, next, _ := m.ListCompanies(context.Background(), ListOptions{Sort: SortByEmployees, Limit: 2})
+	if _, _, err := m.ListCompanies(context.Background(), ListOptions{Sort: SortByName, Cursor: next}); err != ErrInvalidCursor {
+		t.Errorf("memoryStorage.ListCompanies() error = %v, want %v", err, ErrInvalidCursor)
+	}
+}
+
+func Test_memoryStorage_Errors(t *testing.T) {
+	m := NewMemoryStorage()
+
+	company := generateCompany(uuid.New())
+	m.SaveCompany(context.Background(), company, nil)
+
+	missing := uuid.New()
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{
+			name: "Test memory storage SaveCompany() duplicate",
+			call: func() error { return m.SaveCompany(context.Background(), generateCompany(company.ID), nil) },
+			want: ErrConflict,
+		},
+		{
+			name: "Test memory storage SaveCompany() without id",
+			call: func() error { return m.SaveCompany(context.Background(), generateCompany(uuid.Nil), nil) },
+			want: ErrValidation,
+		},
+		{
+			name: "Test memory storage SaveCompany() with negative employees",
+			call: func() error {
+				c := generateCompany(uuid.New())
+				c.Employees = -1
+				return m.SaveCompany(context.Background(), c, nil)
+			},
+			want: ErrValidation,
+		},
+		{
+			name: "Test memory storage SaveCompany() with unknown company type",
+			call: func() error {
+				c := generateCompany(uuid.New())
+				c.CompanyType = 42
+				return m.SaveCompany(context.Background(), c, nil)
+			},
+			want: ErrValidation,
+		},
+		{
+			name: "Test memory storage GetCompany() missing",
+			call: func() error { _, err := m.GetCompany(context.Background(), missing); return err },
+			want: ErrNotFound,
+		},
+		{
+			name: "Test memory storage UpdateCompany() missing",
+			call: func() error {
+				_, _, err := m.UpdateCompany(context.Background(), missing, AnyVersion, func(*types.Company) error { return nil }, nil)
+				return err
+			},
+			want: ErrNotFound,
+		},
+		{
+			name: "Test memory storage DeleteCompany() missing",
+			call: func() error { _, err := m.DeleteCompany(context.Background(), missing, AnyVersion, nil); return err },
+			want: ErrNotFound,
+		},
+		{
+			name: "Test memory storage DeleteCompany() with stale version",
+			call: func() error { _, err := m.DeleteCompany(context.Background(), company.ID, 2, nil); return err },
+			want: ErrVersionMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_memoryStorage_Outbox(t *testing.T) {
+	m := NewMemoryStorage()
+
+	event := func(name string) EventFunc {
+		return func(before, after *types.Company) (*OutboxMessage, error) {
+			return &OutboxMessage{Topic: "test", Name: name}, nil
+		}
+	}
+
+	company := generateCompany(uuid.New())
+	if err := m.SaveCompany(context.Background(), company, event("created")); err != nil {
+		t.Fatalf("memoryStorage.SaveCompany() error = %v", err)
+	}
+
+	// A failed change must not write the event
+	if err := m.SaveCompany(context.Background(), generateCompany(company.ID), event("duplicate")); err != ErrConflict {
+		t.Fatalf("memoryStorage.SaveCompany() error = %v, want %v", err, ErrConflict)
+	}
+
+	// Update which doesn't change the company must not write the event
+	if _, _, err := m.UpdateCompany(context.Background(), company.ID, AnyVersion, func(*types.Company) error { return nil }, event("updated")); err != nil {
+		t.Fatalf("memoryStorage.UpdateCompany() error = %v", err)
+	}
+
+	if _, err := m.DeleteCompany(context.Background(), company.ID, AnyVersion, event("deleted")); err != nil {
+		t.Fatalf("memoryStorage.DeleteCompany() error = %v", err)
+	}
+
+	msgs, err := m.PendingMessages(10)
+	if err != nil {
+		t.Fatalf("memoryStorage.PendingMessages() error = %v", err)
+	}
+
+	if len(msgs) != 2 || msgs[0].Name != "created" || msgs[1].Name != "deleted" {
+		t.Fatalf("memoryStorage.PendingMessages() = %v, want created and deleted events", msgs)
+	}
+
+	if msgs[0].EventID == uuid.Nil || msgs[0].ID >= msgs[1].ID {
+		t.Errorf("memoryStorage.PendingMessages() = %v, want ordered messages with event ids", msgs)
+	}
+
+	if err := m.MarkFailed(msgs[0].ID, errors.New("broker unavailable")); err != nil {
+		t.Errorf("memoryStorage.MarkFailed() error = %v", err)
+	}
+
+	if err := m.MarkDelivered(msgs[1].ID); err != nil {
+		t.Errorf("memoryStorage.MarkDelivered() error = %v", err)
+	}
+
+	if err := m.MarkDelivered(msgs[1].ID); err != ErrNotFound {
+		t.Errorf("memoryStorage.MarkDelivered() error = %v, want %v", err, ErrNotFound)
+	}
+
+	stats, err := m.OutboxStats()
+	if err != nil {
+		t.Fatalf("memoryStorage.OutboxStats() error = %v", err)
+	}
+
+	if stats.Pending != 1 || stats.OldestCreatedAt.IsZero() {
+		t.Errorf("memoryStorage.OutboxStats() = %v, want one pending message", stats)
+	}
+
+	pending, _ := m.PendingMessages(10)
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError != "broker unavailable" {
+		t.Errorf("memoryStorage.PendingMessages() = %v, want the failed message", pending)
+	}
+}
+
+func Test_memoryStorage_Revocations(t *testing.T) {
+	testRevocations(t, NewMemoryStorage())
+}
+
+func Test_memoryStorage_RefreshTokens(t *testing.T) {
+	testRefreshTokens(t, NewMemoryStorage())
+}
@@ -1,15 +1,24 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kperanovic/epam-systems/api/v1/types"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// timePrecision is the precision of the datetime columns, created by the driver as DATETIME(3).
+const timePrecision = time.Millisecond
+
 type mySQLStorage struct {
 	conn *gorm.DB
 }
@@ -20,17 +29,24 @@ func NewMySQLStorage() *mySQLStorage {
 
 func (m *mySQLStorage) Connect() error {
 	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s)/%s?charset=utf8&parseTime=True&loc=Local",
+		"%s:%s@tcp(%s)/%s?charset=utf8&parseTime=True&loc=Local&clientFoundRows=true",
 		viper.GetString("DB_USER"),
 		viper.GetString("DB_PWD"),
 		viper.GetString("DB_HOST"),
 		viper.GetString("DB_NAME"),
 	)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	// TranslateError makes gorm return its own errors (e.g. gorm.ErrDuplicatedKey)
+	// instead of the driver ones, so they can be mapped to the storage errors.
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return err
 	}
 
+	// Every query is traced in the span of the context set with WithContext.
+	if err := db.Use(newTracingPlugin(otel.GetTracerProvider())); err != nil {
+		return err
+	}
+
 	dbSql, err := db.DB()
 	if err != nil {
 		return err
@@ -40,7 +56,12 @@ func (m *mySQLStorage) Connect() error {
 	dbSql.SetMaxOpenConns(10)
 
 	// Migrate the database
-	if err := db.Migrator().AutoMigrate(&types.CompanyType{}, &types.Company{}); err != nil {
+	if err := db.Migrator().AutoMigrate(&types.CompanyType{}, &types.Company{}, &OutboxMessage{}, &RevokedToken{}, &RevokedUser{}, &RefreshToken{}); err != nil {
+		return err
+	}
+
+	// Seed the company types, keeping the ones that already exist.
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&DefaultCompanyTypes).Error; err != nil {
 		return err
 	}
 
@@ -49,33 +70,443 @@ func (m *mySQLStorage) Connect() error {
 	return nil
 }
 
-func (m *mySQLStorage) SaveCompany(company *types.Company) error {
-	res := m.conn.Create(company)
+func (m *mySQLStorage) SaveCompany(ctx context.Context, company *types.Company, event EventFunc) error {
+	db := m.conn.WithContext(ctx)
+
+	typeExists := func(ct int) (bool, error) {
+		return companyTypeExists(db, ct)
+	}
+
+	if err := validateCompany(company, typeExists); err != nil {
+		return err
+	}
+
+	company.Version = 1
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(company).Error; err != nil {
+			return translateError(err)
+		}
+
+		created := *company
+
+		return writeOutbox(tx, event, nil, &created)
+	})
+}
+
+func (m *mySQLStorage) GetCompany(ctx context.Context, id uuid.UUID) (*types.Company, error) {
+	var company types.Company
+	if err := m.conn.WithContext(ctx).First(&company, "id = ?", id).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return &company, nil
+}
+
+func (m *mySQLStorage) ListCompanies(ctx context.Context, opts ListOptions) ([]*types.Company, string, error) {
+	spec, after, err := opts.normalize()
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := m.conn.WithContext(ctx).Model(&types.Company{})
+
+	if opts.Name != "" {
+		query = query.Where("name LIKE ?", "%"+escapeLike(opts.Name)+"%")
+	}
+
+	if opts.CompanyType != nil {
+		query = query.Where("company_type = ?", *opts.CompanyType)
+	}
+
+	if opts.Registered != nil {
+		query = query.Where("registered = ?", *opts.Registered)
+	}
+
+	if opts.MinEmployees != nil {
+		query = query.Where("employees >= ?", *opts.MinEmployees)
+	}
+
+	if opts.MaxEmployees != nil {
+		query = query.Where("employees <= ?", *opts.MaxEmployees)
+	}
+
+	op, order := ">", "ASC"
+	if spec.desc {
+		op, order = "<", "DESC"
+	}
+
+	// Keyset pagination: continue right after the last company of the previous page.
+	if after != nil {
+		var value interface{} = after.Name
+		if spec.column == SortByEmployees {
+			value = after.Employees
+		}
+
+		query = query.Where(
+			fmt.Sprintf("%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?)", spec.column, op),
+			value, value, after.ID,
+		)
+	}
+
+	var companies []*types.Company
+	err = query.
+		Order(fmt.Sprintf("%s %s, id %s", spec.column, order, order)).
+		Limit(opts.Limit + 1).
+		Find(&companies).Error
+	if err != nil {
+		return nil, "", translateError(err)
+	}
+
+	if len(companies) <= opts.Limit {
+		return companies, "", nil
+	}
+
+	companies = companies[:opts.Limit]
+
+	return companies, newCursor(spec, companies[len(companies)-1]), nil
+}
+
+func (m *mySQLStorage) UpdateCompany(ctx context.Context, id uuid.UUID, version int, update UpdateFunc, event EventFunc) (*types.Company, *types.Company, error) {
+	var before, company types.Company
+
+	err := m.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the row, so concurrent updates are applied one after another.
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&company, "id = ?", id).Error
+		if err != nil {
+			return translateError(err)
+		}
+
+		if err := checkVersion(&company, version); err != nil {
+			return err
+		}
+
+		before = company
+
+		typeExists := func(ct int) (bool, error) {
+			return companyTypeExists(tx, ct)
+		}
+
+		if err := applyUpdate(id, &company, update, typeExists); err != nil {
+			return err
+		}
+
+		// Nothing changed, so there is nothing to save or publish.
+		if unchanged(&before, &company) {
+			company = before
+
+			return nil
+		}
+
+		company.Version = before.Version + 1
 
-	return res.Error
+		// Select("*") makes gorm write zero values as well.
+		// Update is conditional on the version that was read, so it can't overwrite a concurrent change.
+		res := tx.Model(&types.Company{}).
+			Where("id = ? AND version = ?", id, before.Version).
+			Select("*").
+			Updates(&company)
+		if res.Error != nil {
+			return translateError(res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		prev, after := before, company
+
+		return writeOutbox(tx, event, &prev, &after)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &before, &company, nil
 }
 
-func (m *mySQLStorage) GetCompany(id uuid.UUID) (*types.Company, error) {
+func (m *mySQLStorage) DeleteCompany(ctx context.Context, id uuid.UUID, version int, event EventFunc) (*types.Company, error) {
 	var company types.Company
-	if err := m.conn.First(&company, "id = ?", id).Error; err != nil {
+
+	err := m.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Load the company being deleted, so the event can be built from it.
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&company, "id = ?", id).Error
+		if err != nil {
+			return translateError(err)
+		}
+
+		if err := checkVersion(&company, version); err != nil {
+			return err
+		}
+
+		res := tx.Where("id = ? AND version = ?", id, company.Version).Delete(&types.Company{})
+		if res.Error != nil {
+			return translateError(res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		deleted := company
+
+		return writeOutbox(tx, event, &deleted, nil)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return &company, nil
 }
 
-func (m *mySQLStorage) UpdateCompany(id uuid.UUID, company *types.Company) error {
-	if err := m.conn.UpdateColumns(company).Error; err != nil {
-		return err
+func (m *mySQLStorage) PendingMessages(limit int) ([]*OutboxMessage, error) {
+	var msgs []*OutboxMessage
+
+	err := m.conn.
+		Where("delivered_at IS NULL").
+		Order("id").
+		Limit(limit).
+		Find(&msgs).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return msgs, nil
+}
+
+func (m *mySQLStorage) MarkDelivered(id uint64) error {
+	res := m.conn.Model(&OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"delivered_at": time.Now(),
+			"attempts":     gorm.Expr("attempts + 1"),
+		})
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrNotFound
 	}
 
 	return nil
 }
 
-func (m *mySQLStorage) DeleteCompany(id uuid.UUID) error {
-	if err := m.conn.Where("id=?", id).Delete(&types.Company{}).Error; err != nil {
-		return err
+func (m *mySQLStorage) MarkFailed(id uint64, cause error) error {
+	res := m.conn.Model(&OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": truncateError(cause),
+		})
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrNotFound
 	}
 
 	return nil
 }
+
+func (m *mySQLStorage) OutboxStats() (OutboxStats, error) {
+	var row struct {
+		Pending int64
+		Oldest  *time.Time
+	}
+
+	err := m.conn.Model(&OutboxMessage{}).
+		Select("COUNT(*) AS pending, MIN(created_at) AS oldest").
+		Where("delivered_at IS NULL").
+		Scan(&row).Error
+	if err != nil {
+		return OutboxStats{}, translateError(err)
+	}
+
+	stats := OutboxStats{Pending: row.Pending}
+	if row.Oldest != nil {
+		stats.OldestCreatedAt = *row.Oldest
+	}
+
+	return stats, nil
+}
+
+func (m *mySQLStorage) RevokeToken(ctx context.Context, token *RevokedToken) error {
+	err := m.conn.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(token).Error
+
+	return translateError(err)
+}
+
+// RevokeUser stores the revocation time truncated to the column precision,
+// since MySQL would round it and could move it after the tokens it revokes.
+func (m *mySQLStorage) RevokeUser(ctx context.Context, user *RevokedUser) error {
+	stored := *user
+	stored.RevokedBefore = user.RevokedBefore.Truncate(timePrecision)
+
+	err := m.conn.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"revoked_before": gorm.Expr("GREATEST(revoked_before, VALUES(revoked_before))"),
+				"expires_at":     gorm.Expr("GREATEST(expires_at, VALUES(expires_at))"),
+			}),
+		}).
+		Create(&stored).Error
+
+	return translateError(err)
+}
+
+func (m *mySQLStorage) IsRevoked(ctx context.Context, tokenID, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	db := m.conn.WithContext(ctx)
+
+	var tokens int64
+	if err := db.Model(&RevokedToken{}).Where("token_id = ?", tokenID).Count(&tokens).Error; err != nil {
+		return false, translateError(err)
+	}
+
+	if tokens > 0 {
+		return true, nil
+	}
+
+	// Token issued in the same millisecond as the revocation can't be told apart
+	// from the ones issued before it, so it is revoked as well.
+	var users int64
+	err := db.Model(&RevokedUser{}).
+		Where("user_id = ? AND revoked_before >= ?", userID, issuedAt.Truncate(timePrecision)).
+		Count(&users).Error
+	if err != nil {
+		return false, translateError(err)
+	}
+
+	return users > 0, nil
+}
+
+func (m *mySQLStorage) PruneRevocations(ctx context.Context, now time.Time) (int64, error) {
+	var pruned int64
+
+	err := m.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("expires_at < ?", now).Delete(&RevokedToken{})
+		if res.Error != nil {
+			return res.Error
+		}
+		pruned += res.RowsAffected
+
+		res = tx.Where("expires_at < ?", now).Delete(&RevokedUser{})
+		if res.Error != nil {
+			return res.Error
+		}
+		pruned += res.RowsAffected
+
+		return nil
+	})
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return pruned, nil
+}
+
+func (m *mySQLStorage) SaveRefreshToken(ctx context.Context, token *RefreshToken) error {
+	return translateError(m.conn.WithContext(ctx).Create(token).Error)
+}
+
+func (m *mySQLStorage) GetRefreshToken(ctx context.Context, hash string) (*RefreshToken, error) {
+	var token RefreshToken
+
+	if err := m.conn.WithContext(ctx).Where("hash = ?", hash).First(&token).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return &token, nil
+}
+
+func (m *mySQLStorage) RotateRefreshToken(ctx context.Context, hash string, usedAt time.Time, next *RefreshToken) error {
+	return m.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The conditional update makes the use atomic, only one of the concurrent uses succeeds.
+		res := tx.Model(&RefreshToken{}).
+			Where("hash = ? AND used_at IS NULL AND revoked_at IS NULL", hash).
+			Update("used_at", usedAt)
+		if res.Error != nil {
+			return translateError(res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			if err := tx.Where("hash = ?", hash).First(&RefreshToken{}).Error; err != nil {
+				return translateError(err)
+			}
+
+			return ErrConflict
+		}
+
+		return translateError(tx.Create(next).Error)
+	})
+}
+
+func (m *mySQLStorage) RevokeRefreshFamily(ctx context.Context, familyID uuid.UUID, revokedAt time.Time) error {
+	err := m.conn.WithContext(ctx).Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", revokedAt).Error
+
+	return translateError(err)
+}
+
+func (m *mySQLStorage) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID, revokedAt time.Time) error {
+	err := m.conn.WithContext(ctx).Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", revokedAt).Error
+
+	return translateError(err)
+}
+
+func (m *mySQLStorage) PruneRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	res := m.conn.WithContext(ctx).Where("expires_at < ?", now).Delete(&RefreshToken{})
+	if res.Error != nil {
+		return 0, translateError(res.Error)
+	}
+
+	return res.RowsAffected, nil
+}
+
+// writeOutbox builds the event for the change and stores it in the outbox
+// using the transaction of the change.
+func writeOutbox(tx *gorm.DB, event EventFunc, before, after *types.Company) error {
+	msg, err := buildEvent(event, before, after)
+	if err != nil || msg == nil {
+		return err
+	}
+
+	return translateError(tx.Create(msg).Error)
+}
+
+// likeEscaper escapes the LIKE wildcards, so they are matched literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes the value for a LIKE pattern using the default escape character.
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+// companyTypeExists checks if the company type exists using the given connection or transaction.
+func companyTypeExists(db *gorm.DB, id int) (bool, error) {
+	var count int64
+	if err := db.Model(&types.CompanyType{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// translateError maps gorm errors to the storage errors.
+// Other errors are returned unchanged.
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrConflict
+	default:
+		return err
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -98,13 +99,17 @@ func TestMySQLStorage_SaveCompany(t *testing.T) {
 		CompanyType: 1,
 	}
 
-	err := db.SaveCompany(company)
+	err := db.SaveCompany(context.Background(), company, nil)
 	assert.Equal(t, err, nil)
 
-	got, err := db.GetCompany(company.ID)
+	got, err := db.GetCompany(context.Background(), company.ID)
 	assert.Equal(t, err, nil)
 	assert.Equal(t, got, company)
 
+	// Saving the same company twice should return ErrConflict
+	err = db.SaveCompany(context.Background(), company, nil)
+	assert.Equal(t, err, ErrConflict)
+
 	Clear(db.conn)
 }
 
@@ -121,16 +126,39 @@ func TestMySQLStorage_UpdateCompany(t *testing.T) {
 	}
 
 	// Insert new row
-	err := db.SaveCompany(company)
+	err := db.SaveCompany(context.Background(), company, nil)
 	assert.Equal(t, err, nil)
 
 	company.Description = "changed description"
+	company.Employees = 0
 
-	err = db.UpdateCompany(company.ID, company)
+	// Zero values have to be written as well
+	before, updated, err := db.UpdateCompany(context.Background(), company.ID, 1, func(current *types.Company) error {
+		*current = *company
+		return nil
+	}, nil)
 	assert.Equal(t, err, nil)
+	assert.Equal(t, updated.Version, 2)
+	assert.Equal(t, before.Description, "description")
+
+	company.Version = 2
+	assert.Equal(t, company, updated)
+
+	// Update which doesn't change the company keeps the version
+	_, unchanged, err := db.UpdateCompany(context.Background(), company.ID, 2, func(current *types.Company) error {
+		return nil
+	}, nil)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, unchanged.Version, 2)
+
+	// Update with a stale version has to fail
+	_, _, err = db.UpdateCompany(context.Background(), company.ID, 1, func(current *types.Company) error {
+		return nil
+	}, nil)
+	assert.Equal(t, err, ErrVersionMismatch)
 
 	// Check if update is correct
-	got, err := db.GetCompany(company.ID)
+	got, err := db.GetCompany(context.Background(), company.ID)
 	assert.Equal(t, err, nil)
 	assert.Equal(t, company, got)
 
@@ -150,16 +178,82 @@ func TestMySQLStorage_DeleteCompany(t *testing.T) {
 	}
 
 	// Insert new row
-	err := db.SaveCompany(company)
+	err := db.SaveCompany(context.Background(), company, nil)
 	assert.Equal(t, err, nil)
 
-	err = db.DeleteCompany(company.ID)
+	// Delete with a stale version has to fail
+	_, err = db.DeleteCompany(context.Background(), company.ID, 2, nil)
+	assert.Equal(t, err, ErrVersionMismatch)
+
+	deleted, err := db.DeleteCompany(context.Background(), company.ID, 1, nil)
 	assert.Equal(t, err, nil)
+	assert.Equal(t, deleted.Name, company.Name)
 
 	// Check if update is correct
-	got, err := db.GetCompany(company.ID)
-	assert.Equal(t, err, gorm.ErrRecordNotFound)
+	got, err := db.GetCompany(context.Background(), company.ID)
+	assert.Equal(t, err, ErrNotFound)
 	assert.Equal(t, got, nil)
 
+	// Deleting a missing company should return ErrNotFound
+	_, err = db.DeleteCompany(context.Background(), company.ID, AnyVersion, nil)
+	assert.Equal(t, err, ErrNotFound)
+
+	Clear(db.conn)
+}
+
+func TestMySQLStorage_ListCompanies(t *testing.T) {
+	setDefaultEnv()
+
+	for i := 1; i <= 3; i++ {
+		company := &types.Company{
+			ID:          uuid.New(),
+			Name:        fmt.Sprintf("list-%d", i),
+			Description: "description",
+			Employees:   i * 10,
+			Registered:  false,
+			CompanyType: 1,
+		}
+
+		err := db.SaveCompany(context.Background(), company, nil)
+		assert.Equal(t, err, nil)
+	}
+
+	minEmployees := 20
+
+	// Fetch first page
+	got, next, err := db.ListCompanies(context.Background(), ListOptions{Name: "list-", MinEmployees: &minEmployees, Sort: "-employees", Limit: 1})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(got), 1)
+	assert.Equal(t, got[0].Employees, 30)
+	assert.NotEqual(t, next, "")
+
+	// Fetch second and last page
+	got, next, err = db.ListCompanies(context.Background(), ListOptions{Name: "list-", MinEmployees: &minEmployees, Sort: "-employees", Limit: 1, Cursor: next})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(got), 1)
+	assert.Equal(t, got[0].Employees, 20)
+	assert.Equal(t, next, "")
+
+	// LIKE wildcards in the name filter are matched literally
+	got, _, err = db.ListCompanies(context.Background(), ListOptions{Name: "_"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(got), 0)
+
+	got, _, err = db.ListCompanies(context.Background(), ListOptions{Name: "list%"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(got), 0)
+
 	Clear(db.conn)
 }
+
+func TestMySQLStorage_Revocations(t *testing.T) {
+	setDefaultEnv()
+
+	testRevocations(t, db)
+}
+
+func TestMySQLStorage_RefreshTokens(t *testing.T) {
+	setDefaultEnv()
+
+	testRefreshTokens(t, db)
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+)
+
+// OutboxMessage is an event stored in the same transaction as the company change that caused it.
+// Messages are published to Kafka by the outbox relay and marked as delivered afterwards,
+// so an event is never lost if the broker is unavailable at the time of the change.
+type OutboxMessage struct {
+	// ID is an auto increment sequence which defines the publishing order.
+	ID uint64 `gorm:"primaryKey;autoIncrement"`
+	// EventID uniquely identifies the event.
+	EventID uuid.UUID `gorm:"uniqueIndex"`
+	// Topic is optional. If it is empty, message is routed to the topics by its name when published.
+	Topic string `gorm:"size:255"`
+	Key   string `gorm:"size:255"`
+	// Name is the message name sent in the "x-message-name" header.
+	Name    string            `gorm:"size:100"`
+	Payload []byte            `gorm:"type:blob"`
+	Headers map[string]string `gorm:"serializer:json"`
+
+	CreatedAt   time.Time
+	DeliveredAt *time.Time `gorm:"index"`
+	Attempts    int
+	LastError   string `gorm:"size:1000"`
+}
+
+// OutboxStats describes the messages waiting to be published.
+type OutboxStats struct {
+	// Pending is the number of undelivered messages.
+	Pending int64
+	// OldestCreatedAt is the creation time of the oldest undelivered message.
+	// It is zero if there are no pending messages.
+	OldestCreatedAt time.Time
+}
+
+// Lag returns how long the oldest pending message has been waiting.
+func (s OutboxStats) Lag(now time.Time) time.Duration {
+	if s.Pending == 0 {
+		return 0
+	}
+
+	return now.Sub(s.OldestCreatedAt)
+}
+
+// EventFunc builds the outbox message for a company change.
+// before is nil for created companies and after is nil for deleted ones.
+// Returning a nil message skips the event.
+type EventFunc func(before, after *types.Company) (*OutboxMessage, error)
+
+// Outbox is implemented by storages which can hold outbox messages.
+type Outbox interface {
+	// PendingMessages returns up to limit undelivered messages in the order they were created.
+	PendingMessages(limit int) ([]*OutboxMessage, error)
+	// MarkDelivered marks the message as published.
+	MarkDelivered(id uint64) error
+	// MarkFailed records a failed publish attempt of the message.
+	MarkFailed(id uint64, cause error) error
+	// OutboxStats returns the statistics of undelivered messages.
+	OutboxStats() (OutboxStats, error)
+}
+
+// maxLastErrorSize is the size of the LastError column.
+const maxLastErrorSize = 1000
+
+// buildEvent runs the event function if it is set and prepares the message for storing.
+func buildEvent(event EventFunc, before, after *types.Company) (*OutboxMessage, error) {
+	if event == nil {
+		return nil, nil
+	}
+
+	msg, err := event(before, after)
+	if err != nil || msg == nil {
+		return nil, err
+	}
+
+	if msg.EventID == uuid.Nil {
+		msg.EventID = uuid.New()
+	}
+
+	return msg, nil
+}
+
+// truncateError returns the error message limited to the LastError column size.
+func truncateError(err error) string {
+	msg := err.Error()
+	if len(msg) > maxLastErrorSize {
+		return msg[:maxLastErrorSize]
+	}
+
+	return msg
+}
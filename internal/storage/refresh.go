@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is a refresh token issued together with an access token.
+// Every use rotates the token: it is marked as used and its successor is issued
+// in the same family, so the reuse of a spent token can revoke the whole family.
+type RefreshToken struct {
+	// Hash is the SHA-256 hash of the token, the token itself is never stored.
+	Hash     string    `gorm:"primaryKey;size:64"`
+	FamilyID uuid.UUID `gorm:"index"`
+	// UserID is the id of the client the token was issued to.
+	UserID uuid.UUID `gorm:"index"`
+	Name   string    `gorm:"size:255"`
+	// Scope is the space separated list of the scopes granted to the family.
+	Scope     string    `gorm:"size:1000"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+	// UsedAt is set once the token is exchanged for its successor.
+	UsedAt *time.Time
+	// RevokedAt is set once the token family is revoked.
+	RevokedAt *time.Time
+}
+
+// RefreshTokens is implemented by storages which can hold the refresh tokens.
+type RefreshTokens interface {
+	SaveRefreshToken(ctx context.Context, token *RefreshToken) error
+	// GetRefreshToken returns the token with the given hash or ErrNotFound.
+	GetRefreshToken(ctx context.Context, hash string) (*RefreshToken, error)
+	// RotateRefreshToken marks the token as used and saves its successor, both or none of them.
+	// Returns ErrConflict if the token was already used or revoked, so a token can only be used once.
+	RotateRefreshToken(ctx context.Context, hash string, usedAt time.Time, next *RefreshToken) error
+	// RevokeRefreshFamily revokes every token of the family.
+	RevokeRefreshFamily(ctx context.Context, familyID uuid.UUID, revokedAt time.Time) error
+	// RevokeUserRefreshTokens revokes every token of the user.
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID, revokedAt time.Time) error
+	// PruneRefreshTokens deletes the tokens which expired before now and returns their number.
+	PruneRefreshTokens(ctx context.Context, now time.Time) (int64, error)
+}
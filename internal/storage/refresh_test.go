@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+)
+
+// testRefreshTokens checks the RefreshTokens implementation of a storage.
+func testRefreshTokens(t *testing.T, r RefreshTokens) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	familyID, userID := uuid.New(), uuid.New()
+
+	newToken := func(familyID uuid.UUID, expiresAt time.Time) *RefreshToken {
+		return &RefreshToken{
+			Hash:      uuid.NewString(),
+			FamilyID:  familyID,
+			UserID:    userID,
+			Name:      "reporting",
+			Scope:     "company:read",
+			ExpiresAt: expiresAt,
+		}
+	}
+
+	saveToken := func(familyID uuid.UUID, expiresAt time.Time) *RefreshToken {
+		token := newToken(familyID, expiresAt)
+		assert.Equal(t, r.SaveRefreshToken(ctx, token), nil)
+
+		return token
+	}
+
+	first := saveToken(familyID, now.Add(time.Hour))
+	assert.Equal(t, r.SaveRefreshToken(ctx, first), ErrConflict)
+
+	got, err := r.GetRefreshToken(ctx, first.Hash)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, got.FamilyID, familyID)
+	assert.Equal(t, got.Scope, "company:read")
+	assert.Equal(t, got.UsedAt, nil)
+
+	_, err = r.GetRefreshToken(ctx, "unknown")
+	assert.Equal(t, err, ErrNotFound)
+
+	// Token can only be used once, its successor is saved together with the use
+	second := newToken(familyID, now.Add(time.Hour))
+	assert.Equal(t, r.RotateRefreshToken(ctx, first.Hash, now, second), nil)
+
+	rejected := newToken(familyID, now.Add(time.Hour))
+	assert.Equal(t, r.RotateRefreshToken(ctx, first.Hash, now, rejected), ErrConflict)
+	assert.Equal(t, r.RotateRefreshToken(ctx, "unknown", now, rejected), ErrNotFound)
+
+	got, err = r.GetRefreshToken(ctx, first.Hash)
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, got.UsedAt, nil)
+
+	got, err = r.GetRefreshToken(ctx, second.Hash)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, got.UsedAt, nil)
+
+	// Successor of a rejected rotation isn't saved
+	_, err = r.GetRefreshToken(ctx, rejected.Hash)
+	assert.Equal(t, err, ErrNotFound)
+
+	// Revoking the family revokes its successor, but not the other families
+	other := saveToken(uuid.New(), now.Add(2*time.Hour))
+
+	assert.Equal(t, r.RevokeRefreshFamily(ctx, familyID, now), nil)
+	assert.Equal(t, r.RotateRefreshToken(ctx, second.Hash, now, rejected), ErrConflict)
+
+	got, err = r.GetRefreshToken(ctx, other.Hash)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, got.RevokedAt, nil)
+
+	// Revoking the user revokes all of its families
+	assert.Equal(t, r.RevokeUserRefreshTokens(ctx, userID, now), nil)
+
+	got, err = r.GetRefreshToken(ctx, other.Hash)
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, got.RevokedAt, nil)
+
+	// Expired tokens are pruned
+	pruned, err := r.PruneRefreshTokens(ctx, now.Add(90*time.Minute))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, pruned, int64(2))
+
+	_, err = r.GetRefreshToken(ctx, first.Hash)
+	assert.Equal(t, err, ErrNotFound)
+
+	_, err = r.GetRefreshToken(ctx, other.Hash)
+	assert.Equal(t, err, nil)
+}
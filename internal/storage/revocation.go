@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevokedToken is a single access token revoked before its expiry.
+type RevokedToken struct {
+	TokenID uuid.UUID `gorm:"primaryKey"`
+	UserID  uuid.UUID
+	// ExpiresAt is the expiry of the token. Revocation is pruned afterwards.
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// RevokedUser revokes every token of the user issued before RevokedBefore.
+type RevokedUser struct {
+	UserID        uuid.UUID `gorm:"primaryKey"`
+	RevokedBefore time.Time
+	// ExpiresAt is the time all the revoked tokens have expired. Revocation is pruned afterwards.
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// Revocations is implemented by storages which can hold the revoked access tokens.
+type Revocations interface {
+	// RevokeToken stores the token revocation. Revoking the token again has no effect.
+	RevokeToken(ctx context.Context, token *RevokedToken) error
+	// RevokeUser stores the revocation of the user tokens.
+	// If the user tokens were already revoked, the later of the times is kept.
+	RevokeUser(ctx context.Context, user *RevokedUser) error
+	// IsRevoked checks if the token was revoked by its id or by its user.
+	IsRevoked(ctx context.Context, tokenID, userID uuid.UUID, issuedAt time.Time) (bool, error)
+	// PruneRevocations deletes the revocations which expired before now and returns their number.
+	PruneRevocations(ctx context.Context, now time.Time) (int64, error)
+}
+
+// later returns the later of the two times.
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+)
+
+// testRevocations checks the Revocations implementation of a storage.
+func testRevocations(t *testing.T, r Revocations) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	tokenID, userID := uuid.New(), uuid.New()
+
+	isRevoked := func(tokenID, userID uuid.UUID, issuedAt time.Time) bool {
+		revoked, err := r.IsRevoked(ctx, tokenID, userID, issuedAt)
+		assert.Equal(t, err, nil)
+
+		return revoked
+	}
+
+	assert.Equal(t, isRevoked(tokenID, userID, now), false)
+
+	// Single token is revoked by its id
+	token := &RevokedToken{TokenID: tokenID, UserID: userID, ExpiresAt: now.Add(time.Hour)}
+	assert.Equal(t, r.RevokeToken(ctx, token), nil)
+	assert.Equal(t, r.RevokeToken(ctx, token), nil)
+
+	assert.Equal(t, isRevoked(tokenID, userID, now), true)
+	assert.Equal(t, isRevoked(uuid.New(), userID, now), false)
+
+	// User tokens are revoked if they were issued before the revocation
+	otherUser := uuid.New()
+	assert.Equal(t, r.RevokeUser(ctx, &RevokedUser{UserID: otherUser, RevokedBefore: now, ExpiresAt: now.Add(2 * time.Hour)}), nil)
+
+	assert.Equal(t, isRevoked(uuid.New(), otherUser, now.Add(-time.Minute)), true)
+	assert.Equal(t, isRevoked(uuid.New(), otherUser, now.Add(time.Minute)), false)
+
+	// Token issued just before the revocation is revoked, even if the storage rounds the time
+	lastUser := uuid.New()
+	assert.Equal(t, r.RevokeUser(ctx, &RevokedUser{UserID: lastUser, RevokedBefore: now.Add(400 * time.Microsecond), ExpiresAt: now.Add(time.Hour)}), nil)
+	assert.Equal(t, isRevoked(uuid.New(), lastUser, now.Add(200*time.Microsecond)), true)
+	assert.Equal(t, isRevoked(uuid.New(), lastUser, now.Add(time.Second)), false)
+
+	// Earlier revocation doesn't undo the later one
+	assert.Equal(t, r.RevokeUser(ctx, &RevokedUser{UserID: otherUser, RevokedBefore: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}), nil)
+	assert.Equal(t, isRevoked(uuid.New(), otherUser, now.Add(-time.Minute)), true)
+
+	// Revocations are pruned once they expire
+	pruned, err := r.PruneRevocations(ctx, now.Add(90*time.Minute))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, pruned, int64(2))
+
+	assert.Equal(t, isRevoked(tokenID, userID, now), false)
+	assert.Equal(t, isRevoked(uuid.New(), otherUser, now.Add(-time.Minute)), true)
+
+	pruned, err = r.PruneRevocations(ctx, now.Add(3*time.Hour))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, pruned, int64(1))
+
+	assert.Equal(t, isRevoked(uuid.New(), otherUser, now.Add(-time.Minute)), false)
+}
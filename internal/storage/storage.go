@@ -1,14 +1,41 @@
 package storage
 
 import (
+	"context"
+
 	"github.com/google/uuid"
 	"github.com/kperanovic/epam-systems/api/v1/types"
 )
 
+// AnyVersion can be passed to UpdateCompany() and DeleteCompany()
+// to skip the version check.
+const AnyVersion = 0
+
+// UpdateFunc modifies the current state of a company in place.
+// Returning an error aborts the update and the error is returned to the caller unchanged.
+type UpdateFunc func(company *types.Company) error
+
+// Storage holds the companies. Every change can be given an EventFunc whose message
+// is written to the outbox in the same transaction as the change.
+// The context of the request is passed to the database queries.
+// It also holds the revoked access tokens and the refresh tokens.
 type Storage interface {
+	Outbox
+	Revocations
+	RefreshTokens
+
 	Connect() error
-	SaveCompany(*types.Company) error
-	GetCompany(id uuid.UUID) (*types.Company, error)
-	UpdateCompany(uuid.UUID, *types.Company) error
-	DeleteCompany(id uuid.UUID) error
+	SaveCompany(ctx context.Context, company *types.Company, event EventFunc) error
+	GetCompany(ctx context.Context, id uuid.UUID) (*types.Company, error)
+	// ListCompanies returns a single page of companies matching the given options
+	// together with the cursor for the next page. The cursor is empty on the last page.
+	ListCompanies(ctx context.Context, opts ListOptions) ([]*types.Company, string, error)
+	// UpdateCompany loads the company, applies the update function and saves the result atomically.
+	// Update is only applied if the stored version matches the given one and the version is incremented.
+	// Returns the company before and after the update. If the update doesn't change the company,
+	// nothing is saved, the version is kept and no event is written.
+	UpdateCompany(ctx context.Context, id uuid.UUID, version int, update UpdateFunc, event EventFunc) (before, after *types.Company, err error)
+	// DeleteCompany deletes the company if the stored version matches the given one.
+	// Returns the deleted company.
+	DeleteCompany(ctx context.Context, id uuid.UUID, version int, event EventFunc) (*types.Company, error)
 }
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	// tracerName is the instrumentation name of the query spans.
+	tracerName = "github.com/kperanovic/epam-systems/internal/storage"
+	// spanKey is the gorm instance key the span of the running statement is stored under.
+	spanKey = "tracing:span"
+)
+
+// tracingPlugin is a gorm plugin starting a client span for every query.
+// Spans are children of the span in the statement context, set with gorm.DB.WithContext.
+type tracingPlugin struct {
+	tracer oteltrace.Tracer
+}
+
+func newTracingPlugin(tp oteltrace.TracerProvider) *tracingPlugin {
+	return &tracingPlugin{tracer: tp.Tracer(tracerName)}
+}
+
+// Name implements gorm.Plugin.
+func (p *tracingPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize implements gorm.Plugin. It registers the callbacks around every gorm operation.
+func (p *tracingPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("tracing:before_create", p.before("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", p.after),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", p.before("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", p.after),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", p.before("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", p.after),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", p.before("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", p.after),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", p.before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", p.after),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", p.before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", p.after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// before starts the span of the operation.
+func (p *tracingPlugin) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		_, span := p.tracer.Start(db.Statement.Context, "gorm."+operation,
+			oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+			oteltrace.WithAttributes(semconv.DBSystemMySQL, semconv.DBOperation(operation)),
+		)
+
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+// after records the executed statement and its result and ends the span.
+func (p *tracingPlugin) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+
+	span := v.(oteltrace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBStatement(db.Statement.SQL.String()),
+		semconv.DBSQLTable(db.Statement.Table),
+	)
+
+	// Missing record is a valid result, not a failed query.
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
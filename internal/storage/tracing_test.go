@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+	"github.com/kperanovic/epam-systems/api/v1/types"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func Test_tracingPlugin(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	// Dry run builds the statements without a database connection
+	db, err := gorm.Open(mysql.New(mysql.Config{SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, db.Use(newTracingPlugin(tp)), nil)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+
+	company := &types.Company{ID: uuid.New(), Name: "test-company"}
+	assert.Equal(t, db.WithContext(ctx).Create(company).Error, nil)
+	assert.Equal(t, db.WithContext(ctx).Where("name = ?", "test-company").Find(&[]types.Company{}).Error, nil)
+	parent.End()
+
+	// Queries are traced as children of the span in the context
+	spans := recorder.Ended()
+	assert.Equal(t, len(spans), 3)
+
+	for i, name := range []string{"gorm.create", "gorm.query"} {
+		span := spans[i]
+		assert.Equal(t, span.Name(), name)
+		assert.Equal(t, span.Parent().SpanID(), parent.SpanContext().SpanID())
+
+		attrs := map[string]string{}
+		for _, kv := range span.Attributes() {
+			attrs[string(kv.Key)] = kv.Value.Emit()
+		}
+
+		assert.Equal(t, attrs[string(semconv.DBSystemKey)], "mysql")
+		assert.Equal(t, attrs[string(semconv.DBSQLTableKey)], "companies")
+		assert.NotEqual(t, attrs[string(semconv.DBStatementKey)], "")
+	}
+}
@@ -0,0 +1,82 @@
+// Package telemetry configures the OpenTelemetry tracing of the service.
+// Spans are exported to an OTLP collector, written to the standard output,
+// or not recorded at all, depending on the configured exporter.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// Supported span exporters.
+const (
+	// ExporterNone doesn't record any spans. Trace context is still propagated.
+	ExporterNone = "none"
+	// ExporterStdout writes the spans to the standard output, useful for local testing.
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends the spans to an OTLP collector over HTTP.
+	ExporterOTLP = "otlp"
+)
+
+// Config configures the tracing.
+type Config struct {
+	// Exporter is one of none, stdout or otlp.
+	Exporter    string
+	ServiceName string
+	// Endpoint is the host and port of the OTLP collector.
+	// If it is empty, the exporter reads it from the OTEL_EXPORTER_OTLP_ENDPOINT variable or uses localhost:4318.
+	Endpoint string
+	// Insecure disables TLS of the OTLP connection.
+	Insecure bool
+}
+
+// Setup registers the tracer provider and the W3C trace context propagator globally.
+// The returned function flushes the pending spans and stops the exporter.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter %q", cfg.Exporter)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s tracing exporter: %w", cfg.Exporter, err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
@@ -0,0 +1,53 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		wantErr  bool
+	}{
+		{
+			name:     "Test no exporter",
+			exporter: ExporterNone,
+		},
+		{
+			name:     "Test stdout exporter",
+			exporter: ExporterStdout,
+		},
+		{
+			name:     "Test OTLP exporter",
+			exporter: ExporterOTLP,
+		},
+		{
+			name:     "Test unsupported exporter",
+			exporter: "jaeger",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), Config{
+				Exporter:    tt.exporter,
+				ServiceName: "test",
+				Endpoint:    "127.0.0.1:4318",
+				Insecure:    true,
+			})
+			assert.Equal(t, err != nil, tt.wantErr)
+
+			if err == nil {
+				// Trace context is propagated even if the spans are not exported
+				assert.Equal(t, otel.GetTextMapPropagator(), propagation.TraceContext{})
+				assert.Equal(t, shutdown(context.Background()), nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// JWKS is a JSON Web Key Set (RFC 7517) holding the public keys the tokens are verified with.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK is a public JSON Web Key. Members not used by the key type are left empty.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA public key.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP (Ed25519) public key.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// KeySet is implemented by the tokens which can be verified with published public keys.
+type KeySet interface {
+	// JWKS returns the public keys the tokens are verified with.
+	JWKS() JWKS
+}
+
+// newJWK encodes the public key as a signature JWK.
+// Key id is the JWK thumbprint (RFC 7638), so it doesn't change as long as the key doesn't.
+func newJWK(public crypto.PublicKey, alg string) (JWK, error) {
+	jwk := JWK{Use: "sig", Alg: alg}
+
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBase64(public.N.Bytes())
+		jwk.E = encodeBase64(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+
+		jwk.Kty = "EC"
+		jwk.Crv = public.Curve.Params().Name
+		jwk.X = encodeBase64(public.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeBase64(public.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeBase64(public)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	thumbprint, err := jwk.thumbprint()
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk.Kid = thumbprint
+
+	return jwk, nil
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the key: the SHA-256 hash of
+// the required members, serialized in lexicographic order.
+func (j JWK) thumbprint() (string, error) {
+	var members interface{}
+
+	// Structs are marshaled in the field order, which has to be lexicographic.
+	switch j.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Crv, j.Kty, j.X, j.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return encodeBase64(sum[:]), nil
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -28,8 +28,8 @@ func NewJWTToken(secretKey string) (*JWTToken, error) {
 // CreateToken will create a new Payload{} struct with the given inputs.
 // Token is then signed with jwt.SigningMethodHS256.
 // Returns a complete,signed JWT.
-func (j *JWTToken) CreateToken(id uuid.UUID, name string, duration time.Duration) (string, error) {
-	payload, err := NewPayload(id, name, duration)
+func (j *JWTToken) CreateToken(id uuid.UUID, name string, duration time.Duration, scopes ...string) (string, error) {
+	payload, err := NewPayload(id, name, duration, scopes...)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,200 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// minRSAKeySize is the smallest RSA key accepted for signing.
+const minRSAKeySize = 2048
+
+// KeyPairToken signs the tokens with a private key, so they can be verified
+// by anyone holding the public key, published as a JSON Web Key Set.
+// Signing algorithm follows from the key type: RS256 for RSA keys,
+// ES256 for ECDSA P-256 keys and EdDSA for Ed25519 keys.
+type KeyPairToken struct {
+	key *signingKey
+}
+
+// NewKeyPairToken creates a KeyPairToken from the PEM encoded private key.
+// Keys are accepted in PKCS #8, PKCS #1 (RSA) and SEC 1 (ECDSA) form.
+func NewKeyPairToken(privateKeyPEM []byte) (*KeyPairToken, error) {
+	key, err := parseSigningKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyPairToken{key: key}, nil
+}
+
+// LoadKeyPairToken creates a KeyPairToken from the PEM encoded private key file.
+func LoadKeyPairToken(path string) (*KeyPairToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing key: %w", err)
+	}
+
+	return NewKeyPairToken(data)
+}
+
+// CreateToken will create a new Payload{} struct with the given inputs.
+// Token is signed with the private key and its key id is set in the "kid" header.
+func (k *KeyPairToken) CreateToken(id uuid.UUID, name string, duration time.Duration, scopes ...string) (string, error) {
+	payload, err := NewPayload(id, name, duration, scopes...)
+	if err != nil {
+		return "", err
+	}
+
+	return k.key.sign(payload)
+}
+
+// VerifyToken checks if the token is valid and signed with the private key.
+func (k *KeyPairToken) VerifyToken(token string) (*Payload, error) {
+	return verifyToken(token, func(kid string) *signingKey {
+		// Tokens without a key id are accepted as well, since there is a single key.
+		if kid == "" || kid == k.key.id {
+			return k.key
+		}
+
+		return nil
+	})
+}
+
+// JWKS returns the public key as a JSON Web Key Set.
+func (k *KeyPairToken) JWKS() JWKS {
+	return JWKS{Keys: []JWK{*k.key.jwk}}
+}
+
+// signingKey is a signing key together with its signing method.
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	// signKey and verifyKey are passed to the signing method. They are the same for HMAC secrets.
+	signKey   interface{}
+	verifyKey interface{}
+	// jwk is the published public key, nil for HMAC secrets.
+	jwk *JWK
+}
+
+func (s *signingKey) sign(payload *Payload) (string, error) {
+	jwtToken := jwt.NewWithClaims(s.method, payload)
+	jwtToken.Header["kid"] = s.id
+
+	return jwtToken.SignedString(s.signKey)
+}
+
+// newSecretKey creates the HMAC (HS256) signing key from the shared secret.
+func newSecretKey(id, secret string) (*signingKey, error) {
+	if len(secret) < minSecretKeySize {
+		return nil, fmt.Errorf("invalid key size: key must have at least %d characters", minSecretKeySize)
+	}
+
+	return &signingKey{
+		id:        id,
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}, nil
+}
+
+// verifyToken verifies the token with the key returned for its key id.
+// Only the signing method of the key is accepted, so a public key can't be used as an HMAC secret.
+func verifyToken(token string, keyByID func(kid string) *signingKey) (*Payload, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key := keyByID(kid)
+		if key == nil || token.Method.Alg() != key.method.Alg() {
+			return nil, ErrInvalidToken
+		}
+
+		return key.verifyKey, nil
+	}
+
+	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, ok := jwtToken.Claims.(*Payload)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return payload, nil
+}
+
+// parseSigningKey parses the PEM encoded private key and chooses its signing method.
+func parseSigningKey(data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+
+	var (
+		private interface{}
+		err     error
+	)
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing signing key: %w", err)
+	}
+
+	var method jwt.SigningMethod
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < minRSAKeySize {
+			return nil, fmt.Errorf("rsa signing key must have at least %d bits", minRSAKeySize)
+		}
+
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if private.Curve != elliptic.P256() {
+			return nil, errors.New("ecdsa signing key must use the P-256 curve")
+		}
+
+		method = jwt.SigningMethodES256
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", private)
+	}
+
+	// All the supported private keys implement crypto.Signer.
+	public := private.(crypto.Signer).Public()
+
+	jwk, err := newJWK(public, method.Alg())
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingKey{
+		id:        jwk.Kid,
+		method:    method,
+		signKey:   private,
+		verifyKey: public,
+		jwk:       &jwk,
+	}, nil
+}
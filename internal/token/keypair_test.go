@@ -0,0 +1,237 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// pkcs8PEM encodes the private key in the PKCS #8 PEM form.
+func pkcs8PEM(t *testing.T, key crypto.Signer) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Equal(t, err, nil)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// publicKey decodes the public key from the JWK, the way a verifying service would.
+func publicKey(t *testing.T, jwk JWK) crypto.PublicKey {
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		assert.Equal(t, err, nil)
+
+		return b
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(decode(jwk.N)),
+			E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64()),
+		}
+	case "EC":
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(decode(jwk.X)),
+			Y:     new(big.Int).SetBytes(decode(jwk.Y)),
+		}
+	default:
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+}
+
+func TestKeyPairToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, err, nil)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Equal(t, err, nil)
+
+	ecDer, err := x509.MarshalECPrivateKey(ecKey)
+	assert.Equal(t, err, nil)
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantAlg string
+		wantKty string
+	}{
+		{
+			name:    "Test RS256 with PKCS #8 key",
+			pem:     pkcs8PEM(t, rsaKey),
+			wantAlg: "RS256",
+			wantKty: "RSA",
+		},
+		{
+			name:    "Test RS256 with PKCS #1 key",
+			pem:     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			wantAlg: "RS256",
+			wantKty: "RSA",
+		},
+		{
+			name:    "Test ES256 with PKCS #8 key",
+			pem:     pkcs8PEM(t, ecKey),
+			wantAlg: "ES256",
+			wantKty: "EC",
+		},
+		{
+			name:    "Test ES256 with SEC 1 key",
+			pem:     pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDer}),
+			wantAlg: "ES256",
+			wantKty: "EC",
+		},
+		{
+			name:    "Test EdDSA",
+			pem:     pkcs8PEM(t, edKey),
+			wantAlg: "EdDSA",
+			wantKty: "OKP",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewKeyPairToken(tt.pem)
+			assert.Equal(t, err, nil)
+
+			id := uuid.New()
+
+			token, err := k.CreateToken(id, "test-company", 20*time.Second, "company:write")
+			assert.Equal(t, err, nil)
+
+			payload, err := k.VerifyToken(token)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, payload.UserID, id)
+			assert.Equal(t, payload.Scope, "company:write")
+
+			// Published key verifies the token without the private key
+			jwks := k.JWKS()
+			assert.Equal(t, len(jwks.Keys), 1)
+
+			jwk := jwks.Keys[0]
+			assert.Equal(t, jwk.Alg, tt.wantAlg)
+			assert.Equal(t, jwk.Kty, tt.wantKty)
+			assert.Equal(t, jwk.Use, "sig")
+
+			parsed, err := jwt.ParseWithClaims(token, &Payload{}, func(token *jwt.Token) (interface{}, error) {
+				assert.Equal(t, token.Header["kid"], jwk.Kid)
+
+				return publicKey(t, jwk), nil
+			}, jwt.WithValidMethods([]string{tt.wantAlg}))
+			assert.Equal(t, err, nil)
+			assert.Equal(t, parsed.Valid, true)
+
+			// Expired token is rejected
+			token, err = k.CreateToken(id, "test-company", -20*time.Second)
+			assert.Equal(t, err, nil)
+
+			payload, err = k.VerifyToken(token)
+			assert.NotEqual(t, err, nil)
+			assert.Equal(t, payload, nil)
+		})
+	}
+}
+
+func TestKeyPairToken_KeyID(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, err, nil)
+
+	// Key id depends only on the public key, not on the PEM form
+	pkcs8, err := NewKeyPairToken(pkcs8PEM(t, key))
+	assert.Equal(t, err, nil)
+
+	pkcs1, err := NewKeyPairToken(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, pkcs8.JWKS().Keys[0].Kid, pkcs1.JWKS().Keys[0].Kid)
+}
+
+func TestKeyPairToken_InvalidToken(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+
+	k, err := NewKeyPairToken(pkcs8PEM(t, ecKey))
+	assert.Equal(t, err, nil)
+
+	payload, err := NewPayload(uuid.New(), "test-company", 20*time.Second)
+	assert.Equal(t, err, nil)
+
+	// Token signed with another key
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+
+	other, err := NewKeyPairToken(pkcs8PEM(t, otherKey))
+	assert.Equal(t, err, nil)
+
+	token, err := other.CreateToken(uuid.New(), "test-company", 20*time.Second)
+	assert.Equal(t, err, nil)
+
+	_, err = k.VerifyToken(token)
+	assert.NotEqual(t, err, nil)
+
+	// Token signed with HMAC, using the public key as the secret
+	publicDer, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	assert.Equal(t, err, nil)
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+	token, err = jwtToken.SignedString(publicDer)
+	assert.Equal(t, err, nil)
+
+	_, err = k.VerifyToken(token)
+	assert.NotEqual(t, err, nil)
+
+	// Token signed with the key without the key id is accepted
+	jwtToken = jwt.NewWithClaims(jwt.SigningMethodES256, payload)
+	token, err = jwtToken.SignedString(ecKey)
+	assert.Equal(t, err, nil)
+
+	_, err = k.VerifyToken(token)
+	assert.Equal(t, err, nil)
+}
+
+func TestNewKeyPairToken_Invalid(t *testing.T) {
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Equal(t, err, nil)
+
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.Equal(t, err, nil)
+
+	tests := []struct {
+		name string
+		pem  []byte
+	}{
+		{
+			name: "Test not PEM encoded",
+			pem:  []byte("not a key"),
+		},
+		{
+			name: "Test small RSA key",
+			pem:  pkcs8PEM(t, smallKey),
+		},
+		{
+			name: "Test ECDSA key on another curve",
+			pem:  pkcs8PEM(t, p384Key),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewKeyPairToken(tt.pem)
+			assert.NotEqual(t, err, nil)
+			assert.Equal(t, k, nil)
+		})
+	}
+}
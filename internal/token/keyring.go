@@ -0,0 +1,319 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultGracePeriod is the default time a retired key is still accepted for verification.
+	DefaultGracePeriod = 24 * time.Hour
+	// DefaultReloadInterval is the default time between two checks of the keyring file.
+	DefaultReloadInterval = 30 * time.Second
+)
+
+// KeyConfig is a single key of the keyring file. Key is either an HMAC (HS256)
+// shared secret or a PEM encoded private key file, see NewKeyPairToken.
+type KeyConfig struct {
+	// ID is sent in the "kid" header of the tokens signed with the key.
+	// It is required for secrets and defaults to the JWK thumbprint for private keys.
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+	// PrivateKeyFile is resolved relative to the keyring file.
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	// RetiredAt is the RFC 3339 time the key stopped signing tokens. It is empty for the active key.
+	RetiredAt time.Time `mapstructure:"retired_at"`
+}
+
+// KeyringConfig is the content of the keyring file.
+type KeyringConfig struct {
+	// GracePeriod is the time a retired key is still accepted after RetiredAt.
+	// It should be longer than the longest token TTL.
+	GracePeriod time.Duration `mapstructure:"grace_period"`
+	Keys        []KeyConfig   `mapstructure:"keys"`
+}
+
+// ringKey is a keyring key with the end of its grace period.
+type ringKey struct {
+	*signingKey
+	// acceptUntil is zero for the active key.
+	acceptUntil time.Time
+}
+
+// Keyring signs the tokens with its active key and verifies them with the key
+// named in their "kid" header. Retired keys are accepted until their grace period
+// ends, so keys can be rotated without invalidating the outstanding tokens.
+//
+// Keys are read from a JSON or YAML file, which Run reloads when it is modified.
+type Keyring struct {
+	log      *zap.Logger
+	path     string
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.RWMutex
+	active  *signingKey
+	keys    map[string]*ringKey
+	modTime time.Time
+}
+
+// LoadKeyring reads the keyring file.
+// Zero interval is replaced with the DefaultReloadInterval.
+func LoadKeyring(log *zap.Logger, path string, interval time.Duration) (*Keyring, error) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	k := &Keyring{
+		log:      log,
+		path:     path,
+		interval: interval,
+		now:      time.Now,
+	}
+
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Reload reads the keyring file again. Current keys are kept if the file is invalid.
+func (k *Keyring) Reload() error {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return fmt.Errorf("error reading keyring file: %w", err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(k.path)
+
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("error reading keyring file: %w", err)
+	}
+
+	var cfg KeyringConfig
+	hooks := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToTimeHookFunc(time.RFC3339),
+	))
+
+	if err := v.Unmarshal(&cfg, hooks); err != nil {
+		return fmt.Errorf("error decoding keyring file: %w", err)
+	}
+
+	// Unlike the other durations, zero grace period is valid, so only a missing one gets the default.
+	if !v.IsSet("grace_period") {
+		cfg.GracePeriod = DefaultGracePeriod
+	}
+
+	active, keys, err := newKeys(cfg, filepath.Dir(k.path))
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.active = active
+	k.keys = keys
+	k.modTime = info.ModTime()
+
+	return nil
+}
+
+// Run reloads the keyring when its file is modified, until the context is done.
+func (k *Keyring) Run(ctx context.Context) {
+	k.log.Info("watching keyring file", zap.String("path", k.path), zap.Duration("interval", k.interval))
+
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			k.log.Info("stopping keyring watch")
+
+			return
+		case <-ticker.C:
+			if !k.modified() {
+				continue
+			}
+
+			if err := k.Reload(); err != nil {
+				k.log.Error("error reloading keyring", zap.Error(err))
+
+				continue
+			}
+
+			k.log.Info("reloaded keyring", zap.String("activeKey", k.activeKey().id))
+		}
+	}
+}
+
+// CreateToken will create a new Payload{} struct with the given inputs.
+// Token is signed with the active key and its id is set in the "kid" header.
+func (k *Keyring) CreateToken(id uuid.UUID, name string, duration time.Duration, scopes ...string) (string, error) {
+	payload, err := NewPayload(id, name, duration, scopes...)
+	if err != nil {
+		return "", err
+	}
+
+	return k.activeKey().sign(payload)
+}
+
+// VerifyToken checks if the token is valid and signed with the active key
+// or with a retired key within its grace period.
+// Tokens without a key id are verified with the active key.
+func (k *Keyring) VerifyToken(token string) (*Payload, error) {
+	return verifyToken(token, func(kid string) *signingKey {
+		k.mu.RLock()
+		defer k.mu.RUnlock()
+
+		if kid == "" {
+			return k.active
+		}
+
+		key, ok := k.keys[kid]
+		if !ok || !k.accepted(key) {
+			return nil
+		}
+
+		return key.signingKey
+	})
+}
+
+// JWKS returns the public keys of the accepted private keys. Secrets are never published.
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, key := range k.keys {
+		if key.jwk != nil && k.accepted(key) {
+			jwks.Keys = append(jwks.Keys, *key.jwk)
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+
+	return jwks
+}
+
+func (k *Keyring) activeKey() *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+// accepted checks if the key is active or within its grace period.
+func (k *Keyring) accepted(key *ringKey) bool {
+	return key.acceptUntil.IsZero() || k.now().Before(key.acceptUntil)
+}
+
+// modified checks if the keyring file changed since it was last read.
+func (k *Keyring) modified() bool {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		k.log.Error("error reading keyring file", zap.Error(err))
+
+		return false
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return !info.ModTime().Equal(k.modTime)
+}
+
+// newKeys validates the keyring configuration and returns the active key and all keys by id.
+func newKeys(cfg KeyringConfig, dir string) (*signingKey, map[string]*ringKey, error) {
+	if cfg.GracePeriod < 0 {
+		return nil, nil, errors.New("keyring grace period can't be negative")
+	}
+
+	var active *signingKey
+	keys := make(map[string]*ringKey, len(cfg.Keys))
+
+	for i, c := range cfg.Keys {
+		key, err := newKey(c, dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("keyring key %d: %w", i, err)
+		}
+
+		if _, ok := keys[key.id]; ok {
+			return nil, nil, fmt.Errorf("keyring key %d: duplicate key id %q", i, key.id)
+		}
+
+		rk := &ringKey{signingKey: key}
+
+		if c.RetiredAt.IsZero() {
+			if active != nil {
+				return nil, nil, fmt.Errorf("keyring key %d: keys %q and %q are both active", i, active.id, key.id)
+			}
+
+			active = key
+		} else {
+			rk.acceptUntil = c.RetiredAt.Add(cfg.GracePeriod)
+		}
+
+		keys[key.id] = rk
+	}
+
+	if active == nil {
+		return nil, nil, errors.New("keyring has no active key")
+	}
+
+	return active, keys, nil
+}
+
+// newKey creates the signing key from its configuration.
+func newKey(c KeyConfig, dir string) (*signingKey, error) {
+	switch {
+	case c.Secret != "" && c.PrivateKeyFile != "":
+		return nil, errors.New("key can't have both a secret and a private key file")
+	case c.Secret != "":
+		if c.ID == "" {
+			return nil, errors.New("secret key has to have an id")
+		}
+
+		return newSecretKey(c.ID, c.Secret)
+	case c.PrivateKeyFile != "":
+		path := c.PrivateKeyFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading signing key: %w", err)
+		}
+
+		key, err := parseSigningKey(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.ID != "" {
+			key.id = c.ID
+			key.jwk.Kid = c.ID
+		}
+
+		return key, nil
+	default:
+		return nil, errors.New("key has to have a secret or a private key file")
+	}
+}
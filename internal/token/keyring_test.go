@@ -0,0 +1,325 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	keyringSecretA = "KLguRWx03zXcWwDXywrxgwTS7r39QaF1"
+	keyringSecretB = "x9Tq2hVw7LmZpR4sKd8NcYbF3jG6eUaQ"
+)
+
+// writeKeyring writes the keyring file and moves its modification time,
+// so a rewrite within the file system time resolution is noticed as well.
+func writeKeyring(t *testing.T, path, content string, modTime time.Time) {
+	err := os.WriteFile(path, []byte(content), 0o600)
+	assert.Equal(t, err, nil)
+
+	err = os.Chtimes(path, modTime, modTime)
+	assert.Equal(t, err, nil)
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keyring.yaml")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+
+	err = os.WriteFile(filepath.Join(dir, "2026-10.pem"), pkcs8PEM(t, ecKey), 0o600)
+	assert.Equal(t, err, nil)
+
+	writeKeyring(t, path, `
+keys:
+  - id: 2026-07
+    secret: `+keyringSecretA+`
+`, time.Unix(1000, 0))
+
+	k, err := LoadKeyring(zap.NewNop(), path, 0)
+	assert.Equal(t, err, nil)
+
+	// Shared secrets aren't published
+	assert.Equal(t, k.JWKS().Keys, []JWK{})
+
+	id := uuid.New()
+
+	oldToken, err := k.CreateToken(id, "test-company", time.Hour)
+	assert.Equal(t, err, nil)
+
+	// Rotate to the private key, the secret is retired
+	writeKeyring(t, path, `
+grace_period: 2h
+keys:
+  - id: 2026-10
+    private_key_file: 2026-10.pem
+  - id: 2026-07
+    secret: `+keyringSecretA+`
+    retired_at: "2026-10-01T12:00:00Z"
+`, time.Unix(2000, 0))
+
+	err = k.Reload()
+	assert.Equal(t, err, nil)
+
+	k.now = func() time.Time { return time.Date(2026, 10, 1, 13, 0, 0, 0, time.UTC) }
+
+	newToken, err := k.CreateToken(id, "test-company", time.Hour)
+	assert.Equal(t, err, nil)
+
+	kid, err := tokenKeyID(newToken)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, kid, "2026-10")
+
+	jwks := k.JWKS()
+	assert.Equal(t, len(jwks.Keys), 1)
+	assert.Equal(t, jwks.Keys[0].Kid, "2026-10")
+	assert.Equal(t, jwks.Keys[0].Alg, "ES256")
+
+	// Tokens signed with the retired key are accepted within the grace period
+	for _, token := range []string{oldToken, newToken} {
+		payload, err := k.VerifyToken(token)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, payload.UserID, id)
+	}
+
+	// and rejected after it ends
+	k.now = func() time.Time { return time.Date(2026, 10, 1, 14, 0, 0, 0, time.UTC) }
+
+	_, err = k.VerifyToken(oldToken)
+	assert.NotEqual(t, err, nil)
+
+	_, err = k.VerifyToken(newToken)
+	assert.Equal(t, err, nil)
+
+	// Keys which were removed from the file are rejected
+	writeKeyring(t, path, `
+keys:
+  - id: 2026-10
+    private_key_file: 2026-10.pem
+`, time.Unix(3000, 0))
+
+	err = k.Reload()
+	assert.Equal(t, err, nil)
+
+	k.now = func() time.Time { return time.Date(2026, 10, 1, 13, 0, 0, 0, time.UTC) }
+
+	_, err = k.VerifyToken(oldToken)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestKeyring_VerifyToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+
+	writeKeyring(t, path, `{
+  "keys": [
+    {"id": "b", "secret": "`+keyringSecretB+`"},
+    {"id": "a", "secret": "`+keyringSecretA+`", "retired_at": "2026-10-01T12:00:00Z"}
+  ]
+}`, time.Unix(1000, 0))
+
+	k, err := LoadKeyring(zap.NewNop(), path, 0)
+	assert.Equal(t, err, nil)
+
+	k.now = func() time.Time { return time.Date(2026, 10, 1, 13, 0, 0, 0, time.UTC) }
+
+	legacy, err := NewJWTToken(keyringSecretB)
+	assert.Equal(t, err, nil)
+
+	retired, err := NewJWTToken(keyringSecretA)
+	assert.Equal(t, err, nil)
+
+	tests := []struct {
+		name    string
+		token   Token
+		wantErr bool
+	}{
+		{
+			name:  "Test token without key id signed with the active key",
+			token: legacy,
+		},
+		{
+			name:    "Test token without key id signed with a retired key",
+			token:   retired,
+			wantErr: true,
+		},
+		{
+			name:  "Test token signed by the keyring",
+			token: k,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.token.CreateToken(uuid.New(), "test-company", time.Hour)
+			assert.Equal(t, err, nil)
+
+			payload, err := k.VerifyToken(token)
+			assert.Equal(t, err != nil, tt.wantErr)
+			assert.Equal(t, payload == nil, tt.wantErr)
+		})
+	}
+}
+
+func TestKeyring_Run(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.yaml")
+
+	writeKeyring(t, path, `
+keys:
+  - id: a
+    secret: `+keyringSecretA+`
+`, time.Unix(1000, 0))
+
+	k, err := LoadKeyring(zap.NewNop(), path, 10*time.Millisecond)
+	assert.Equal(t, err, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go k.Run(ctx)
+
+	// Invalid file is ignored and the current keys are kept
+	writeKeyring(t, path, `keys: []`, time.Unix(2000, 0))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, k.activeKey().id, "a")
+
+	writeKeyring(t, path, `
+keys:
+  - id: b
+    secret: `+keyringSecretB+`
+  - id: a
+    secret: `+keyringSecretA+`
+    retired_at: 2026-10-01T12:00:00Z
+`, time.Unix(3000, 0))
+
+	deadline := time.Now().Add(time.Second)
+	for k.activeKey().id != "b" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, k.activeKey().id, "b")
+}
+
+func TestLoadKeyring_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "Test no keys",
+			content: `keys: []`,
+		},
+		{
+			name: "Test no active key",
+			content: `
+keys:
+  - id: a
+    secret: ` + keyringSecretA + `
+    retired_at: "2026-10-01T12:00:00Z"
+`,
+		},
+		{
+			name: "Test two active keys",
+			content: `
+keys:
+  - id: a
+    secret: ` + keyringSecretA + `
+  - id: b
+    secret: ` + keyringSecretB + `
+`,
+		},
+		{
+			name: "Test duplicate key id",
+			content: `
+keys:
+  - id: a
+    secret: ` + keyringSecretA + `
+  - id: a
+    secret: ` + keyringSecretB + `
+    retired_at: "2026-10-01T12:00:00Z"
+`,
+		},
+		{
+			name: "Test secret without id",
+			content: `
+keys:
+  - secret: ` + keyringSecretA + `
+`,
+		},
+		{
+			name: "Test short secret",
+			content: `
+keys:
+  - id: a
+    secret: short
+`,
+		},
+		{
+			name: "Test secret and private key file",
+			content: `
+keys:
+  - id: a
+    secret: ` + keyringSecretA + `
+    private_key_file: a.pem
+`,
+		},
+		{
+			name: "Test missing private key file",
+			content: `
+keys:
+  - id: a
+    private_key_file: a.pem
+`,
+		},
+		{
+			name: "Test invalid retired_at",
+			content: `
+keys:
+  - id: b
+    secret: ` + keyringSecretB + `
+  - id: a
+    secret: ` + keyringSecretA + `
+    retired_at: yesterday
+`,
+		},
+		{
+			name: "Test negative grace period",
+			content: `
+grace_period: -1h
+keys:
+  - id: a
+    secret: ` + keyringSecretA + `
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keyring.yaml")
+			writeKeyring(t, path, tt.content, time.Unix(1000, 0))
+
+			k, err := LoadKeyring(zap.NewNop(), path, 0)
+			assert.NotEqual(t, err, nil)
+			assert.Equal(t, k, nil)
+		})
+	}
+}
+
+// tokenKeyID returns the "kid" header of the token without verifying it.
+func tokenKeyID(token string) (string, error) {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Payload{})
+	if err != nil {
+		return "", err
+	}
+
+	kid, _ := parsed.Header["kid"].(string)
+
+	return kid, nil
+}
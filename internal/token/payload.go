@@ -2,6 +2,7 @@ package token
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -22,10 +23,12 @@ type Payload struct {
 	UserID    uuid.UUID `json:"user_id"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiredAt time.Time `json:"expired_at"`
+	// Scope is the space separated list of the granted scopes (RFC 8693).
+	Scope string `json:"scope,omitempty"`
 }
 
 // NewPayload will create a new token payload
-func NewPayload(id uuid.UUID, name string, duration time.Duration) (*Payload, error) {
+func NewPayload(id uuid.UUID, name string, duration time.Duration, scopes ...string) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -37,11 +40,23 @@ func NewPayload(id uuid.UUID, name string, duration time.Duration) (*Payload, er
 		UserID:    id,
 		IssuedAt:  time.Now(),
 		ExpiredAt: time.Now().Add(duration),
+		Scope:     strings.Join(scopes, " "),
 	}
 
 	return payload, nil
 }
 
+// HasScope reports whether the token grants the scope.
+func (p *Payload) HasScope(scope string) bool {
+	for _, s := range strings.Fields(p.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (p *Payload) GetExpirationTime() (*jwt.NumericDate, error) {
 	return jwt.NewNumericDate(p.ExpiredAt), nil
 }
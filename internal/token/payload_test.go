@@ -13,3 +13,16 @@ func TestNewPayload(t *testing.T) {
 	assert.Equal(t, err, nil)
 	assert.NotEqual(t, payload, nil)
 }
+
+func TestPayload_HasScope(t *testing.T) {
+	payload, err := NewPayload(uuid.New(), "test", 20*time.Second, "company:read", "company:write")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, payload.Scope, "company:read company:write")
+	assert.Equal(t, payload.HasScope("company:write"), true)
+	assert.Equal(t, payload.HasScope("company"), false)
+
+	// Token without scopes grants none
+	payload, err = NewPayload(uuid.New(), "test", 20*time.Second)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, payload.HasScope("company:read"), false)
+}
@@ -7,8 +7,8 @@ import (
 )
 
 type Token interface {
-	// CreateToken creates a new token for a specific name and duration.
-	CreateToken(id uuid.UUID, name string, duration time.Duration) (string, error)
+	// CreateToken creates a new token for a specific name and duration, granting the scopes.
+	CreateToken(id uuid.UUID, name string, duration time.Duration, scopes ...string) (string, error)
 	// Verify token checks if the provided token is valid.
 	VerifyToken(token string) (*Payload, error)
 }
@@ -0,0 +1,187 @@
+// Package trace contains helper functions for parsing
+// and passing the W3C trace context (https://www.w3.org/TR/trace-context/)
+// using the context package. Trace context is received in the
+// traceparent and tracestate HTTP headers and forwarded in the
+// Kafka record headers of the same names.
+//
+// Trace context is stored in the context as the OpenTelemetry span context,
+// so the spans started from the context continue the trace, and the
+// forwarded headers identify the current span.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TraceParentHeader defines the trace parent header name.
+	TraceParentHeader = "traceparent"
+	// TraceStateHeader defines the trace state header name.
+	TraceStateHeader = "tracestate"
+)
+
+// version is the only trace context version this package produces.
+const version = "00"
+
+// flagSampled marks the trace as sampled.
+const flagSampled = 0x01
+
+// maxTraceStateSize is the trace state size propagators have to support.
+// Larger trace states are dropped.
+const maxTraceStateSize = 512
+
+var errInvalidTraceParent = errors.New("invalid traceparent")
+
+// Context is a W3C trace context.
+type Context struct {
+	TraceID  [16]byte
+	ParentID [8]byte
+	Flags    byte
+	// State is the vendor specific tracestate header, forwarded unchanged.
+	State string
+}
+
+// New will return a new sampled trace context with random ids.
+func New() Context {
+	var tc Context
+
+	// crypto/rand.Read never fails on supported platforms.
+	_, _ = rand.Read(tc.TraceID[:])
+	_, _ = rand.Read(tc.ParentID[:])
+	tc.Flags = flagSampled
+
+	return tc
+}
+
+// Parse will parse the traceparent and tracestate header values.
+// Trace state is only kept if the trace parent is valid.
+func Parse(traceparent, tracestate string) (Context, error) {
+	var tc Context
+
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, errInvalidTraceParent
+	}
+
+	// Future versions can append fields, but version 00 has exactly four.
+	if parts[0] == version && len(parts) != 4 {
+		return tc, errInvalidTraceParent
+	}
+
+	if err := decodeHex(tc.TraceID[:], parts[1]); err != nil {
+		return tc, err
+	}
+
+	if err := decodeHex(tc.ParentID[:], parts[2]); err != nil {
+		return tc, err
+	}
+
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return tc, err
+	}
+	tc.Flags = flags[0]
+
+	if tc.TraceID == [16]byte{} || tc.ParentID == [8]byte{} {
+		return tc, errInvalidTraceParent
+	}
+
+	if len(tracestate) <= maxTraceStateSize {
+		tc.State = strings.TrimSpace(tracestate)
+	}
+
+	return tc, nil
+}
+
+// TraceParent will return the traceparent header value.
+func (tc Context) TraceParent() string {
+	return version + "-" + hex.EncodeToString(tc.TraceID[:]) + "-" +
+		hex.EncodeToString(tc.ParentID[:]) + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// TraceIDString will return the hex encoded trace id.
+func (tc Context) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// Sampled reports whether the caller may have recorded the trace.
+func (tc Context) Sampled() bool {
+	return tc.Flags&flagSampled != 0
+}
+
+// WithContext will return a new context
+// which contains the trace context as the remote parent span.
+func WithContext(ctx context.Context, tc Context) context.Context {
+	// Trace state which isn't valid is dropped.
+	state, _ := oteltrace.ParseTraceState(tc.State)
+
+	return oteltrace.ContextWithRemoteSpanContext(ctx, oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    tc.TraceID,
+		SpanID:     tc.ParentID,
+		TraceFlags: oteltrace.TraceFlags(tc.Flags),
+		TraceState: state,
+		Remote:     true,
+	}))
+}
+
+// FromContext will return the trace context of
+// the current span in the received context if it exists.
+func FromContext(ctx context.Context) (Context, bool) {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return Context{}, false
+	}
+
+	return Context{
+		TraceID:  sc.TraceID(),
+		ParentID: sc.SpanID(),
+		Flags:    byte(sc.TraceFlags()),
+		State:    sc.TraceState().String(),
+	}, true
+}
+
+// FromHeaders will return the trace context from the headers map.
+// It returns false if the headers don't contain a valid trace parent.
+func FromHeaders(headers map[string]string) (Context, bool) {
+	traceparent, ok := headers[TraceParentHeader]
+	if !ok {
+		return Context{}, false
+	}
+
+	tc, err := Parse(traceparent, headers[TraceStateHeader])
+
+	return tc, err == nil
+}
+
+// Inject will set the trace context headers of the context in the headers map.
+// Headers are left unchanged if the context has no trace context.
+func Inject(ctx context.Context, headers map[string]string) {
+	tc, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+
+	headers[TraceParentHeader] = tc.TraceParent()
+	if tc.State != "" {
+		headers[TraceStateHeader] = tc.State
+	}
+}
+
+// decodeHex decodes the lowercase hex string into dst, which has to be filled exactly.
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return errInvalidTraceParent
+	}
+
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return errInvalidTraceParent
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package trace
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		tracestate  string
+		wantState   string
+		wantErr     bool
+	}{
+		{
+			name:        "Test valid trace parent with trace state",
+			traceparent: testTraceParent,
+			tracestate:  "congo=t61rcWkgMzE",
+			wantState:   "congo=t61rcWkgMzE",
+		},
+		{
+			name:        "Test future version with additional fields",
+			traceparent: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		},
+		{
+			name:        "Test too large trace state is dropped",
+			traceparent: testTraceParent,
+			tracestate:  "congo=" + strings.Repeat("a", maxTraceStateSize),
+		},
+		{
+			name:    "Test empty trace parent",
+			wantErr: true,
+		},
+		{
+			name:        "Test version 00 with additional fields",
+			traceparent: testTraceParent + "-extra",
+			wantErr:     true,
+		},
+		{
+			name:        "Test invalid version",
+			traceparent: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantErr:     true,
+		},
+		{
+			name:        "Test uppercase trace id",
+			traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			wantErr:     true,
+		},
+		{
+			name:        "Test short parent id",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01",
+			wantErr:     true,
+		},
+		{
+			name:        "Test zero trace id",
+			traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			wantErr:     true,
+		},
+		{
+			name:        "Test invalid flags",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, err := Parse(tt.traceparent, tt.tracestate)
+			assert.Equal(t, err != nil, tt.wantErr)
+
+			if err == nil {
+				assert.Equal(t, tc.TraceIDString(), "4bf92f3577b34da6a3ce929d0e0e4736")
+				assert.Equal(t, tc.State, tt.wantState)
+				assert.Equal(t, tc.Sampled(), true)
+			}
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	tc, err := Parse(testTraceParent, "congo=t61rcWkgMzE")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, tc.TraceParent(), testTraceParent)
+
+	// Context without trace context leaves the headers unchanged
+	headers := map[string]string{}
+	Inject(context.Background(), headers)
+	assert.Equal(t, len(headers), 0)
+
+	Inject(WithContext(context.Background(), tc), headers)
+	assert.Equal(t, headers, map[string]string{
+		TraceParentHeader: testTraceParent,
+		TraceStateHeader:  "congo=t61rcWkgMzE",
+	})
+
+	// Injected headers are read back as the same trace context
+	got, ok := FromHeaders(headers)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, got, tc)
+
+	_, ok = FromHeaders(map[string]string{})
+	assert.Equal(t, ok, false)
+
+	// New trace contexts are sampled and unique
+	assert.Equal(t, New().Sampled(), true)
+	assert.NotEqual(t, New().TraceID, New().TraceID)
+}
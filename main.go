@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
 	middleware "github.com/kperanovic/epam-systems/api/v1/auth"
 	"github.com/kperanovic/epam-systems/api/v1/handlers"
+	"github.com/kperanovic/epam-systems/api/v1/problem"
 	"github.com/kperanovic/epam-systems/internal/kafka"
 	"github.com/kperanovic/epam-systems/internal/logger"
+	"github.com/kperanovic/epam-systems/internal/oauth"
+	"github.com/kperanovic/epam-systems/internal/outbox"
+	"github.com/kperanovic/epam-systems/internal/refresh"
+	"github.com/kperanovic/epam-systems/internal/revocation"
+	"github.com/kperanovic/epam-systems/internal/spool"
 	"github.com/kperanovic/epam-systems/internal/storage"
+	"github.com/kperanovic/epam-systems/internal/telemetry"
 	"github.com/kperanovic/epam-systems/internal/token"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
 )
 
@@ -23,34 +32,231 @@ func main() {
 
 	log.Info("starting service")
 
+	shutdownTracing, err := telemetry.Setup(context.Background(), telemetry.Config{
+		Exporter:    viper.GetString("TRACING_EXPORTER"),
+		ServiceName: viper.GetString("TRACING_SERVICE_NAME"),
+		Endpoint:    viper.GetString("TRACING_OTLP_ENDPOINT"),
+		Insecure:    viper.GetBool("TRACING_OTLP_INSECURE"),
+	})
+	if err != nil {
+		log.Fatal("error setting up tracing", zap.Error(err))
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error("error flushing spans", zap.Error(err))
+		}
+	}()
+
 	store := storage.NewMySQLStorage()
 	if err := store.Connect(); err != nil {
 		log.Fatal("error establishing connection", zap.Error(err))
 	}
 
-	producer, err := kafka.NewKafkaProducer(
+	topicRoutes, err := kafka.ParseRoutes(viper.GetString("KAFKA_TOPIC_ROUTES"))
+	if err != nil {
+		log.Fatal("invalid kafka topic routes", zap.Error(err))
+	}
+
+	routes := kafka.Routes{
+		Default: viper.GetString("KAFKA_TOPIC"),
+		Prefix:  viper.GetString("KAFKA_TOPIC_PREFIX"),
+		Topics:  topicRoutes,
+	}
+
+	partitioner, err := kafka.ParsePartitioner(viper.GetString("KAFKA_PARTITIONER"))
+	if err != nil {
+		log.Fatal("invalid kafka partitioner", zap.Error(err))
+	}
+
+	compression, err := kafka.ParseCompression(viper.GetString("KAFKA_COMPRESSION"))
+	if err != nil {
+		log.Fatal("invalid kafka compression", zap.Error(err))
+	}
+
+	security := kafka.SecurityConfig{
+		TLS: kafka.TLSConfig{
+			Enabled:    viper.GetBool("KAFKA_TLS_ENABLED"),
+			CAFile:     viper.GetString("KAFKA_TLS_CA_FILE"),
+			CertFile:   viper.GetString("KAFKA_TLS_CERT_FILE"),
+			KeyFile:    viper.GetString("KAFKA_TLS_KEY_FILE"),
+			ServerName: viper.GetString("KAFKA_TLS_SERVER_NAME"),
+		},
+		SASL: kafka.SASLConfig{
+			Mechanism: viper.GetString("KAFKA_SASL_MECHANISM"),
+			Username:  viper.GetString("KAFKA_SASL_USERNAME"),
+			Password:  viper.GetString("KAFKA_SASL_PASSWORD"),
+		},
+	}
+	if err := security.Validate(); err != nil {
+		log.Fatal("invalid kafka security configuration", zap.Error(err))
+	}
+
+	producerCfg := kafka.ProducerConfig{
+		Routes:        routes,
+		Partitioner:   partitioner,
+		Compression:   compression,
+		Security:      security,
+		Idempotent:    viper.GetBool("KAFKA_IDEMPOTENT"),
+		TransactionID: viper.GetString("KAFKA_TRANSACTIONAL_ID"),
+	}
+
+	mode := viper.GetString("KAFKA_PRODUCER_MODE")
+	switch mode {
+	case kafka.ProducerModeSync:
+	case kafka.ProducerModeAsync:
+		producerCfg.Async = true
+		producerCfg.Linger = viper.GetDuration("KAFKA_LINGER")
+		producerCfg.BatchSize = viper.GetInt("KAFKA_BATCH_SIZE")
+		producerCfg.BatchBytes = viper.GetInt("KAFKA_BATCH_BYTES")
+		producerCfg.MaxBuffered = viper.GetInt("KAFKA_MAX_BUFFERED")
+	default:
+		log.Fatal("invalid kafka producer mode", zap.String("mode", mode))
+	}
+
+	// Consumer commits the offset only after the dead-letter message is acknowledged
+	// and spooled messages are removed only after they are replayed,
+	// so both are always sent synchronously.
+	syncCfg := producerCfg
+	syncCfg.Async = false
+
+	syncProducer, err := kafka.NewKafkaProducer(viper.GetStringSlice("KAFKA_ADDR"), syncCfg, log)
+	if err != nil {
+		log.Fatal("error starting kafka producer", zap.Error(err))
+	}
+	defer syncProducer.Close()
+
+	producer := syncProducer
+
+	// Outbox relay waits for the acknowledgements, so undelivered events stay in the outbox.
+	// Messages published one by one by the async producer aren't kept anywhere else,
+	// so the ones it fails to deliver are kept in the spool until replayed.
+	var failed *spool.Spool
+	if producerCfg.Async {
+		failed, err = spool.Open(
+			log,
+			syncProducer,
+			viper.GetString("KAFKA_SPOOL_DIR"),
+			viper.GetInt64("KAFKA_SPOOL_MAX_BYTES"),
+			viper.GetDuration("KAFKA_SPOOL_INTERVAL"),
+		)
+		if err != nil {
+			log.Fatal("error opening kafka spool", zap.Error(err))
+		}
+		defer failed.Close()
+
+		go failed.Run(context.Background())
+
+		producerCfg.Spool = failed
+
+		if producer, err = kafka.NewKafkaProducer(viper.GetStringSlice("KAFKA_ADDR"), producerCfg, log); err != nil {
+			log.Fatal("error starting kafka async producer", zap.Error(err))
+		}
+		defer producer.Close()
+	}
+
+	encoding, err := kafka.ParseEncoding(viper.GetString("KAFKA_EVENT_ENCODING"))
+	if err != nil {
+		log.Fatal("invalid kafka event encoding", zap.Error(err))
+	}
+
+	relay := outbox.NewRelay(
+		log,
+		store,
+		producer,
+		viper.GetDuration("OUTBOX_INTERVAL"),
+		viper.GetInt("OUTBOX_BATCH_SIZE"),
+	)
+	go relay.Run(context.Background())
+
+	consumer, err := kafka.NewKafkaConsumer(
 		viper.GetStringSlice("KAFKA_ADDR"),
-		viper.GetString("KAFKA_TOPIC"),
+		viper.GetString("KAFKA_CONSUMER_GROUP"),
+		[]string{routes.Prefix + viper.GetString("KAFKA_COMMANDS_TOPIC")},
+		security,
+		syncProducer,
+		routes.Prefix+viper.GetString("KAFKA_DLQ_TOPIC"),
 		log,
 	)
 	if err != nil {
-		log.Fatal("error starting kafka producer", zap.Error(err))
+		log.Fatal("error starting kafka consumer", zap.Error(err))
 	}
+	defer consumer.Close()
 
-	h := handlers.NewRESTHandlers(log, store, producer)
+	handlers.NewCommandHandlers(log, store, encoding).Register(consumer)
+	go consumer.Run(context.Background())
+
+	h := handlers.NewRESTHandlers(log, store, encoding).WithProducer(producer)
+	if failed != nil {
+		h.WithSpool(failed)
+	}
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(
+		gin.Logger(),
+		problem.Recovery(),
+		otelgin.Middleware(viper.GetString("TRACING_SERVICE_NAME")),
+		middleware.TraceMiddleware(),
+		middleware.CorrelationMiddleware(log),
+	)
+	r.NoRoute(problem.NoRoute)
 
-	t, err := token.NewJWTToken(viper.GetString("AUTH_SECRET"))
+	t, err := newToken(log)
 	if err != nil {
 		log.Fatal("error creating jwt token instance", zap.Error(err))
 	}
 
-	group := r.Group("v1/company").Use(middleware.AuthMiddleware(t))
+	// Without a clients file no client can request a token.
+	clients, err := oauth.NewRegistry(nil, 0)
+	if path := viper.GetString("AUTH_CLIENTS_FILE"); path != "" {
+		clients, err = oauth.LoadRegistry(path, viper.GetDuration("AUTH_TOKEN_TTL"))
+	}
+	if err != nil {
+		log.Fatal("error loading oauth clients", zap.Error(err))
+	}
+
+	// User revocations are kept until every token issued before them has expired.
+	// Tokens signed with AUTH_SECRET by hand can live longer than the issued ones,
+	// so user revocations are kept until AUTH_MAX_TOKEN_AGE, and older tokens are rejected.
+	maxTTL := clients.MaxTokenTTL()
+	if age := viper.GetDuration("AUTH_MAX_TOKEN_AGE"); age > maxTTL {
+		maxTTL = age
+	}
+
+	revoked := revocation.NewList(log, store, maxTTL, viper.GetDuration("AUTH_REVOCATION_PRUNE_INTERVAL"))
+	go revoked.Run(context.Background())
+
+	auth := middleware.AuthMiddleware(t, revoked)
+
+	refreshTokens := refresh.NewManager(
+		log,
+		store,
+		viper.GetDuration("AUTH_REFRESH_TOKEN_TTL"),
+		viper.GetDuration("AUTH_REFRESH_PRUNE_INTERVAL"),
+	).WithRevoker(revoked)
+	go refreshTokens.Run(context.Background())
+
+	th := handlers.NewTokenHandlers(log, clients, t).
+		WithRevoker(revoked).
+		WithRefreshTokens(refreshTokens)
+	r.POST("/v1/auth/token", th.HandleToken)
+	r.POST("/v1/auth/revoke", auth, th.HandleRevoke)
+	r.GET("/.well-known/jwks.json", th.HandleJWKS)
+
+	group := r.Group("v1/company").Use(auth)
+
+	// Tokens signed with AUTH_SECRET by hand carry no scopes,
+	// so the scopes are only enforced once all clients use the token endpoint.
+	if viper.GetBool("AUTH_REQUIRE_SCOPES") {
+		group.Use(middleware.RequireScope(handlers.ScopeCompanyWrite))
+	}
+
 	group.POST("/", h.HandleCreateCompany)
 	group.PATCH("/:id", h.HandlePatchCompany)
+	group.PUT("/:id", h.HandlePutCompany)
 	group.DELETE("/:id", h.HandleDeleteCompany)
 
+	r.GET("/health", h.HandleHealth)
+	r.GET("/v1/company", h.HandleListCompanies)
 	r.GET("/v1/company/:id", h.HandleGetCompany)
 
 	if err := r.Run(); err != nil {
@@ -58,9 +264,30 @@ func main() {
 	}
 }
 
+// newToken creates the token signed with the keys from AUTH_KEYRING_FILE,
+// with the private key from AUTH_SIGNING_KEY_FILE, or with the AUTH_SECRET shared secret.
+// Keyring file is watched for changes, so the keys can be rotated without a restart.
+func newToken(log *zap.Logger) (token.Token, error) {
+	if path := viper.GetString("AUTH_KEYRING_FILE"); path != "" {
+		keyring, err := token.LoadKeyring(log, path, viper.GetDuration("AUTH_KEYRING_RELOAD_INTERVAL"))
+		if err != nil {
+			return nil, err
+		}
+
+		go keyring.Run(context.Background())
+
+		return keyring, nil
+	}
+
+	if path := viper.GetString("AUTH_SIGNING_KEY_FILE"); path != "" {
+		return token.LoadKeyPairToken(path)
+	}
+
+	return token.NewJWTToken(viper.GetString("AUTH_SECRET"))
+}
+
 func loadParams() error {
 	mandatory := []string{
-		"AUTH_SECRET",
 		"KAFKA_ADDR",
 		"DB_USER",
 		"DB_PWD",
@@ -69,9 +296,37 @@ func loadParams() error {
 	viper.SetDefault("DB_HOST", "127.0.0.1:3306")
 	viper.SetDefault("DB_NAME", "epam")
 	viper.SetDefault("KAFKA_VERSION", "1.0.0")
+	viper.SetDefault("KAFKA_TOPIC", "company.commands")
+	viper.SetDefault("KAFKA_PARTITIONER", kafka.PartitionerHash)
+	viper.SetDefault("KAFKA_PRODUCER_MODE", kafka.ProducerModeSync)
+	viper.SetDefault("KAFKA_COMPRESSION", "none")
+	viper.SetDefault("KAFKA_MAX_BUFFERED", kafka.DefaultMaxBuffered)
+	viper.SetDefault("KAFKA_SPOOL_DIR", "spool")
+	viper.SetDefault("KAFKA_SPOOL_MAX_BYTES", spool.DefaultMaxBytes)
+	viper.SetDefault("KAFKA_SPOOL_INTERVAL", spool.DefaultInterval)
+	viper.SetDefault("KAFKA_EVENT_ENCODING", string(kafka.EncodingProtobuf))
+	viper.SetDefault("KAFKA_CONSUMER_GROUP", "epam-systems")
+	viper.SetDefault("KAFKA_COMMANDS_TOPIC", "company.commands")
+	viper.SetDefault("KAFKA_DLQ_TOPIC", "company.commands.dlq")
+	viper.SetDefault("OUTBOX_INTERVAL", outbox.DefaultInterval)
+	viper.SetDefault("OUTBOX_BATCH_SIZE", outbox.DefaultBatchSize)
+	viper.SetDefault("AUTH_TOKEN_TTL", oauth.DefaultTokenTTL)
+	viper.SetDefault("AUTH_REQUIRE_SCOPES", false)
+	viper.SetDefault("AUTH_KEYRING_RELOAD_INTERVAL", token.DefaultReloadInterval)
+	viper.SetDefault("AUTH_REVOCATION_PRUNE_INTERVAL", revocation.DefaultPruneInterval)
+	viper.SetDefault("AUTH_MAX_TOKEN_AGE", revocation.DefaultMaxTokenAge)
+	viper.SetDefault("AUTH_REFRESH_TOKEN_TTL", refresh.DefaultTTL)
+	viper.SetDefault("AUTH_REFRESH_PRUNE_INTERVAL", refresh.DefaultPruneInterval)
+	viper.SetDefault("TRACING_EXPORTER", telemetry.ExporterNone)
+	viper.SetDefault("TRACING_SERVICE_NAME", "epam-systems")
 
 	viper.AutomaticEnv()
 
+	// Tokens are signed with the keyring, the private key or the shared secret.
+	if !viper.IsSet("AUTH_KEYRING_FILE") && !viper.IsSet("AUTH_SIGNING_KEY_FILE") {
+		mandatory = append(mandatory, "AUTH_SECRET")
+	}
+
 	for _, param := range mandatory {
 		if !viper.IsSet(param) {
 			return fmt.Errorf("mandatory parameters not set (%s)", param)